@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/cert"
+)
+
+// DefaultSocket is the Unix socket the server listens on for admin commands.
+const DefaultSocket = "pppordle-admin.sock"
+
+type Request struct {
+	Command string
+	Args    []string
+}
+
+type Response struct {
+	Error    string
+	Messages []string
+	Sessions []Session
+	Requests []LevelRequest
+	// Cert is the certificate issued by the spectator-cert command.
+	Cert *cert.PemCertPair `json:",omitempty"`
+}
+
+// Session is a live session of the session server.
+type Session struct {
+	ID               uuid.UUID
+	RemoteAddr       string
+	Player           string
+	Level            int
+	RemainingGuesses int
+	Connected        time.Time
+	Spectating       bool
+}
+
+// LevelRequest is a level connection waiting to be linked to its session.
+type LevelRequest struct {
+	LocalAddr  string
+	RemoteAddr string
+	SessionID  uuid.UUID
+}
+
+// Call sends a single command to the server listening on socket.
+func Call(socket string, req Request) (*Response, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin socket: %w", err)
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Response
+	err = json.NewDecoder(conn).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"pppordle/admin"
+	"pppordle/logging"
+)
+
+// handleAdmin serves admin commands on a Unix socket only the server's user
+// can connect to, until ctx is cancelled.
+func handleAdmin(ctx context.Context, cfg *ServerConfig, logger *logging.Logger, levels []*LevelServer) error {
+	socket := cfg.AdminSocket
+
+	err := os.Remove(socket)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove stale admin socket: %w", err)
+	}
+
+	listener, err := listenPrivate(socket)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		os.Remove(socket)
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Warn("admin.accept", "error accepting admin connection", "error", err)
+			continue
+		}
+
+		go func() {
+			defer conn.Close()
+
+			var req admin.Request
+			err := json.NewDecoder(conn).Decode(&req)
+			if err != nil {
+				return
+			}
+
+			logger.Info("admin.command", "admin command", "command", req.Command, "args", req.Args)
+			res := runAdminCommand(req, cfg, levels)
+
+			err = json.NewEncoder(conn).Encode(res)
+			if err != nil {
+				logger.Warn("admin.send", "error sending admin response", "error", err)
+			}
+		}()
+	}
+}
+
+// listenPrivate listens on a Unix socket which only the server's user can
+// connect to. The socket is created in a private directory, where it can be
+// restricted before it is moved to its path and reachable by others.
+func listenPrivate(socket string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socket), ".pppordle-admin-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create admin socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "admin.sock")
+	listener, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(private, 0600)
+	if err == nil {
+		err = os.Rename(private, socket)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unable to restrict admin socket: %w", err)
+	}
+
+	return listener, nil
+}
+
+func runAdminCommand(req admin.Request, cfg *ServerConfig, levels []*LevelServer) *admin.Response {
+	res := &admin.Response{}
+
+	switch req.Command {
+	case "sessions":
+		SessionMutex.Lock()
+		for id, session := range Sessions {
+			res.Sessions = append(res.Sessions, session.Status.Admin(id, session.Conn.RemoteAddr))
+		}
+		SessionMutex.Unlock()
+
+		sort.Slice(res.Sessions, func(i, j int) bool {
+			return res.Sessions[i].Connected.Before(res.Sessions[j].Connected)
+		})
+	case "requests":
+		for _, l := range levels {
+			res.Requests = append(res.Requests, l.Pending()...)
+		}
+	case "kill":
+		if len(req.Args) != 1 {
+			res.Error = "usage: kill <session>"
+			break
+		}
+
+		sessionID, err := uuid.Parse(req.Args[0])
+		if err != nil {
+			res.Error = fmt.Sprintf("invalid session: %v", err)
+			break
+		}
+
+		SessionMutex.Lock()
+		session, ok := Sessions[sessionID]
+		SessionMutex.Unlock()
+		if !ok {
+			res.Error = "Could not find session"
+			break
+		}
+
+		session.Kill()
+		res.Messages = append(res.Messages, fmt.Sprintf("killed session %v", sessionID))
+	case "reload":
+		notes, err := reloadLevels(levels, cfg)
+		res.Messages = notes
+		if err != nil {
+			res.Error = err.Error()
+		}
+	case "certs":
+		for _, c := range Certs.List() {
+			res.Messages = append(res.Messages, fmt.Sprintf("%s level=%d session=%v player=%q revoked=%v",
+				c.Serial, c.Level, c.SessionID, c.Player, c.Revoked))
+		}
+	case "revoke":
+		if len(req.Args) != 1 {
+			res.Error = "usage: revoke <serial|fingerprint|session>"
+			break
+		}
+
+		revoked, err := Certs.Revoke(req.Args[0])
+		for _, c := range revoked {
+			res.Messages = append(res.Messages, fmt.Sprintf("revoked %s (level %d, session %v)", c.Serial, c.Level, c.SessionID))
+		}
+		if err == nil {
+			err = Certs.WriteCRL(pemCA, cfg.CRL)
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+	case "spectator-cert":
+		pair, err := generateClientCert(spectatorCertName, "", cfg.ClientCertValidity.Duration)
+		if err != nil {
+			res.Error = err.Error()
+			break
+		}
+
+		issued, err := Certs.Record(pair, 0, uuid.Nil, "organiser")
+		if err != nil {
+			res.Error = err.Error()
+			break
+		}
+
+		res.Cert = pair
+		res.Messages = append(res.Messages, fmt.Sprintf("issued spectator certificate %s", issued.Serial))
+	default:
+		res.Error = fmt.Sprintf("unknown command %q", req.Command)
+	}
+
+	return res
+}
@@ -0,0 +1,23 @@
+package level
+
+import (
+	_ "embed"
+)
+
+// Assets of the levels of the manifest.
+var (
+	//go:embed assets/level1_wordlist.txt
+	level1WordlistBytes []byte
+
+	//go:embed assets/level2_emojis.txt
+	level2ValidEmojis string
+
+	//go:embed assets/flag1.txt
+	flag1 string
+
+	//go:embed assets/level3_cursed.txt
+	level3Word string
+
+	//go:embed assets/flag2.txt
+	flag2 string
+)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bindingMACSize is the length of the truncated HMAC of a binding token.
+const bindingMACSize = 16
+
+var (
+	ErrInvalidBinding = errors.New("Invalid session token")
+	ErrExpiredBinding = errors.New("Session token expired")
+)
+
+var Bindings *BindingSigner
+
+// BindingSigner issues the tokens which bind a level connection to the session
+// it authenticates. A token is the session ID and an expiry time, signed with
+// a key only this server process knows.
+type BindingSigner struct {
+	key      []byte
+	validity time.Duration
+}
+
+func NewBindingSigner(validity time.Duration) (*BindingSigner, error) {
+	key := make([]byte, sha256.Size)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BindingSigner{
+		key:      key,
+		validity: validity,
+	}, nil
+}
+
+func (b *BindingSigner) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:bindingMACSize]
+}
+
+// Issue returns a token binding a level connection to sessionID.
+func (b *BindingSigner) Issue(sessionID uuid.UUID) string {
+	payload := make([]byte, len(sessionID)+8)
+	copy(payload, sessionID[:])
+	binary.BigEndian.PutUint64(payload[len(sessionID):], uint64(time.Now().Add(b.validity).Unix()))
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, b.mac(payload)...))
+}
+
+// Verify checks the signature and expiry of a token and returns the session
+// it is bound to.
+func (b *BindingSigner) Verify(token string) (uuid.UUID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != len(uuid.UUID{})+8+bindingMACSize {
+		return uuid.Nil, ErrInvalidBinding
+	}
+
+	payload, mac := data[:len(data)-bindingMACSize], data[len(data)-bindingMACSize:]
+	if !hmac.Equal(mac, b.mac(payload)) {
+		return uuid.Nil, ErrInvalidBinding
+	}
+
+	var sessionID uuid.UUID
+	copy(sessionID[:], payload)
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(payload[len(sessionID):])), 0)
+	if time.Now().After(expiry) {
+		return uuid.Nil, ErrExpiredBinding
+	}
+
+	return sessionID, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBindingVerify(t *testing.T) {
+	signer, err := NewBindingSigner(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewBindingSigner(-2 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewBindingSigner(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionID := uuid.New()
+	token := signer.Issue(sessionID)
+
+	// tamper flips a bit of the decoded token at i, counting from the end if
+	// i is negative.
+	tamper := func(i int) string {
+		data, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < 0 {
+			i += len(data)
+		}
+		data[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	tests := []struct {
+		name   string
+		signer *BindingSigner
+		token  string
+		err    error
+	}{
+		{"valid", signer, token, nil},
+		{"expired", expired, expired.Issue(sessionID), ErrExpiredBinding},
+		{"expired token signed by another key", signer, expired.Issue(sessionID), ErrInvalidBinding},
+		{"signed by another key", other, token, ErrInvalidBinding},
+		{"session changed", signer, tamper(0), ErrInvalidBinding},
+		{"expiry changed", signer, tamper(len(uuid.UUID{}) + 7), ErrInvalidBinding},
+		{"signature changed", signer, tamper(-1), ErrInvalidBinding},
+		{"truncated", signer, token[:len(token)-2], ErrInvalidBinding},
+		{"not base64", signer, "!" + token[1:], ErrInvalidBinding},
+		{"empty", signer, "", ErrInvalidBinding},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := test.signer.Verify(test.token)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, test.err)
+			}
+			if err == nil && id != sessionID {
+				t.Errorf("Verify() = %v, want %v", id, sessionID)
+			}
+			if err != nil && id != uuid.Nil {
+				t.Errorf("Verify() = %v with an error, want %v", id, uuid.Nil)
+			}
+		})
+	}
+}
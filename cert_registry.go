@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/cert"
+)
+
+// crlSecsValid is how long a generated revocation list is valid for.
+const crlSecsValid = 60 * 60 * 24
+
+var Certs = &CertRegistry{certs: make(map[string]*IssuedCert)}
+
+// IssuedCert is a level client certificate handed out by the server.
+type IssuedCert struct {
+	Serial      string
+	Fingerprint string
+	Level       int
+	SessionID   uuid.UUID
+	Player      string
+	Issued      time.Time
+	Expires     time.Time
+	Revoked     bool
+	RevokedAt   time.Time
+}
+
+// certEvent is a line of the registry file, which is only ever appended to so
+// that revocations from the command line and the running server can't clobber
+// each other.
+type certEvent struct {
+	Event  string
+	Cert   *IssuedCert `json:",omitempty"`
+	Serial string      `json:",omitempty"`
+	Time   time.Time
+}
+
+// CertRegistry tracks issued client certificates and their revocation.
+type CertRegistry struct {
+	mutex sync.Mutex
+	path  string
+	certs map[string]*IssuedCert
+}
+
+func LoadCertRegistry(path string) (*CertRegistry, error) {
+	registry := &CertRegistry{
+		path:  path,
+		certs: make(map[string]*IssuedCert),
+	}
+
+	err := registry.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Reload replays the registry file, picking up revocations made by other
+// processes. The registry is locked throughout, so that certificates recorded
+// meanwhile are either in the file or wait for the reload to finish.
+func (r *CertRegistry) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	certs := make(map[string]*IssuedCert)
+
+	f, err := os.Open(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		r.certs = certs
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event certEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return fmt.Errorf("corrupt certificate registry: %w", err)
+		}
+
+		switch event.Event {
+		case "issue":
+			if event.Cert != nil {
+				certs[event.Cert.Serial] = event.Cert
+			}
+		case "revoke":
+			c, ok := certs[event.Serial]
+			if ok {
+				c.Revoked = true
+				c.RevokedAt = event.Time
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	r.certs = certs
+	return nil
+}
+
+func (r *CertRegistry) append(event certEvent) error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Record registers a certificate issued to the player of a session.
+func (r *CertRegistry) Record(pair *cert.PemCertPair, level int, sessionID uuid.UUID, player string) (*IssuedCert, error) {
+	block, _ := pem.Decode(pair.Cert)
+	if block == nil {
+		return nil, errors.New("certificate is not PEM encoded")
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &IssuedCert{
+		Serial:      parsed.SerialNumber.Text(16),
+		Fingerprint: certFingerprint(parsed),
+		Level:       level,
+		SessionID:   sessionID,
+		Player:      player,
+		Issued:      parsed.NotBefore,
+		Expires:     parsed.NotAfter,
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.certs[issued.Serial] = issued
+	return issued, r.append(certEvent{
+		Event: "issue",
+		Cert:  issued,
+		Time:  time.Now(),
+	})
+}
+
+// Revoke revokes the certificates matching a serial, a fingerprint or the
+// session they were issued to, returning the revoked certificates.
+func (r *CertRegistry) Revoke(match string) ([]IssuedCert, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var revoked []IssuedCert
+	now := time.Now()
+	for _, c := range r.certs {
+		if c.Revoked || (c.Serial != match && c.Fingerprint != match && c.SessionID.String() != match) {
+			continue
+		}
+
+		err := r.append(certEvent{
+			Event:  "revoke",
+			Serial: c.Serial,
+			Time:   now,
+		})
+		if err != nil {
+			return revoked, err
+		}
+
+		c.Revoked = true
+		c.RevokedAt = now
+		revoked = append(revoked, *c)
+	}
+
+	if len(revoked) == 0 {
+		return nil, fmt.Errorf("no unrevoked certificate matches %q", match)
+	}
+
+	return revoked, nil
+}
+
+func (r *CertRegistry) IsRevoked(serial *big.Int) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.certs[serial.Text(16)]
+	return ok && c.Revoked
+}
+
+// List returns the registered certificates, oldest first.
+func (r *CertRegistry) List() []IssuedCert {
+	r.mutex.Lock()
+	var certs []IssuedCert
+	for _, c := range r.certs {
+		certs = append(certs, *c)
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].Issued.Before(certs[j].Issued)
+	})
+
+	return certs
+}
+
+// WriteCRL writes the revocation list of the registry, signed by the CA, to
+// path.
+func (r *CertRegistry) WriteCRL(ca *cert.PemCertPair, path string) error {
+	var revoked []pkix.RevokedCertificate
+	for _, c := range r.List() {
+		if !c.Revoked || time.Now().After(c.Expires) {
+			continue
+		}
+
+		serial, ok := new(big.Int).SetString(c.Serial, 16)
+		if !ok {
+			return fmt.Errorf("invalid serial %q", c.Serial)
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: c.RevokedAt,
+		})
+	}
+
+	crl, err := cert.MakeCRL(ca, revoked, big.NewInt(time.Now().Unix()), crlSecsValid)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, crl, 0644)
+}
@@ -24,13 +24,21 @@ type CertConfig struct {
 	CommonName string
 	DNSNames   []string
 	SecsValid  uint
+	// Player identifies the player a client certificate is issued to, see
+	// Player.
+	Player string
+}
+
+// Player returns the player a client certificate was issued to. It is kept in
+// the subject serial number so that it carries over from level to level.
+func Player(c *x509.Certificate) string {
+	return c.Subject.SerialNumber
 }
 
 // Reference: https://shaneutt.com/blog/golang-ca-and-signed-cert-go/
 func MakeCerts(config CertConfig) (*PemCertPair, error) {
 	var extKeyUsage []x509.ExtKeyUsage
 	var keyUsage x509.KeyUsage
-	var ok bool
 
 	if config.IsClient {
 		extKeyUsage = append(extKeyUsage, x509.ExtKeyUsageClientAuth)
@@ -55,6 +63,7 @@ func MakeCerts(config CertConfig) (*PemCertPair, error) {
 			Locality:     []string{"Pittsburgh"},
 			Organization: []string{"PlaidCTF"},
 			CommonName:   config.CommonName,
+			SerialNumber: config.Player,
 		},
 		DNSNames:              config.DNSNames,
 		NotBefore:             time.Now(),
@@ -73,21 +82,10 @@ func MakeCerts(config CertConfig) (*PemCertPair, error) {
 	parent := cert
 	parentKey := privKey
 	if config.Parent != nil {
-		block, _ := pem.Decode(config.Parent.Cert)
-		parent, err = x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return nil, err
-		}
-
-		block, _ = pem.Decode(config.Parent.Key)
-		parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		parent, parentKey, err = parsePair(config.Parent)
 		if err != nil {
 			return nil, err
 		}
-		parentKey, ok = parsedKey.(ed25519.PrivateKey)
-		if !ok {
-			return nil, errors.New("key of signer is incorrect type")
-		}
 	}
 	rawCert, err := x509.CreateCertificate(rand.Reader, cert, parent, pubKey, parentKey)
 	if err != nil {
@@ -114,3 +112,54 @@ func MakeCerts(config CertConfig) (*PemCertPair, error) {
 		Key:  pemKey,
 	}, nil
 }
+
+// MakeCRL builds a PEM encoded revocation list signed by the CA.
+func MakeCRL(ca *PemCertPair, revoked []pkix.RevokedCertificate, number *big.Int, secsValid uint) ([]byte, error) {
+	caCert, caKey, err := parsePair(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	rawCRL, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              number,
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(time.Second * time.Duration(secsValid)),
+	}, caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "X509 CRL",
+		Bytes: rawCRL,
+	}), nil
+}
+
+func parsePair(pair *PemCertPair) (*x509.Certificate, ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(pair.Cert)
+	if block == nil {
+		return nil, nil, errors.New("certificate is not PEM encoded")
+	}
+	parsedCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ = pem.Decode(pair.Key)
+	if block == nil {
+		return nil, nil, errors.New("key is not PEM encoded")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := parsedKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("key of signer is incorrect type")
+	}
+
+	return parsedCert, key, nil
+}
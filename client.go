@@ -1,129 +1,72 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
-	"time"
-	"errors"
-	"fmt"
+	"flag"
 	"io"
 	"log"
-	"net"
 	"os"
 
-	"github.com/rivo/tview"
-
-	"pppordle/game"
-)
-
-const (
-	sessionPort = 1337
+	"pppordle/check"
+	"pppordle/pkg/client"
 )
 
+// player makes the catalog, leaderboard and spectator requests, games are
+// played with clients of their own sharing its config. It is nil offline.
 var (
-	domain = "pppordle.chal.pwni.ng"
-	dev = os.Getenv("PPPORDLE_ENV")
+	player       *client.Client
+	clientConfig client.Config
 )
 
-func main() {
-	log.SetOutput(io.Discard)
-
-	if dev == "dev" {
-		domain = "localhost"
-	}
+// hintWords are the words hints are picked from.
+var hintWords []string
 
-	startUI()
-}
-
-func startSession(level int, loadingText *tview.TextView) (net.Conn, error) {
-	sessionServer := net.JoinHostPort(domain, fmt.Sprint(sessionPort))
-	levelServer := net.JoinHostPort(domain, fmt.Sprint(sessionPort+level))
-
-	certName := "certs/ca.pem"
-	if dev == "dev" {
-		certName = "certs/dev_ca.pem"
-	}
-
-	ca, err := os.ReadFile(certName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open CA cert file: %w", err)
-	}
-	caCertPool := x509.NewCertPool()
-	ok := caCertPool.AppendCertsFromPEM(ca)
-	if !ok {
-		return nil, errors.New("Failed to add ca cert to pool")
-	}
-
-	tlsConfig := &tls.Config{
-		RootCAs: caCertPool,
+func main() {
+	clientConfig = client.DefaultConfig(os.Getenv("PPPORDLE_ENV") == "dev")
+
+	spectate := flag.Bool("spectate", false, "watch games as they are played")
+	spectateSession := flag.String("session", "", "only spectate the session with this ID")
+	flag.StringVar(&clientConfig.Handle, "handle", "", "name to show on the leaderboard")
+	flag.StringVar(&shareFile, "share-file", "pppordle-share.txt", "file the result grid is saved to")
+	wordlist := flag.String("wordlist", "", "word list of hints and offline games, hints only use the feedback without one")
+	flag.BoolVar(&offline, "offline", false, "play practice games without a server")
+	flag.IntVar(&offlineLength, "length", 5, "word length of offline games")
+	replayPath := flag.String("replay", "", "play back the game of a transcript written by the server")
+	flag.Parse()
+
+	var err error
+	if *wordlist != "" {
+		hintWords, err = client.ReadWordlist(*wordlist)
+		check.Fatal("failed to read word list", err)
 	}
 
-	conn, err := tls.Dial("tcp", sessionServer, tlsConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to session server: %w", err)
+	var transcript *replay
+	if *replayPath != "" {
+		transcript, err = loadReplay(*replayPath)
+		check.Fatal("failed to read transcript", err)
 	}
 
-	initResult, err := makeRequest[*game.InitResult](conn, game.Request{Type: game.RequestInit})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get session init result: %w", err)
+	if offline && (offlineLength < 1 || offlineLength > offlineMaxLength) {
+		log.Fatalf("-length must be between 1 and %d", offlineMaxLength)
 	}
-	log.Printf("received init result: %+v", initResult)
-
-	sessionID := initResult.SessionID
-	tlsConfig.ServerName = fmt.Sprintf("%s.session", sessionID.String())
-
-	if level > 1 {
-		clientPem, err := os.ReadFile(fmt.Sprintf("certs/level%d.pem", level))
-		if err != nil {
-			return nil, fmt.Errorf("unable to read client cert for this level: %w", err)
-		}
-		clientKey, err := os.ReadFile(fmt.Sprintf("certs/level%d.key", level))
-		if err != nil {
-			return nil, fmt.Errorf("unable to read client key for this level: %w", err)
-		}
-
-		clientCert, err := tls.X509KeyPair(clientPem, clientKey)
-		if err != nil {
-			return nil, fmt.Errorf("unable to load client certificate: %w", err)
-		}
-		tlsConfig.Certificates = []tls.Certificate{clientCert}
-	}
-
-	authConn, err := tls.Dial("tcp", levelServer, tlsConfig)
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to connnect to level %d server: %w", level, err)
+	if offline && *spectate {
+		log.Fatal("spectating needs a server, it is not available offline")
 	}
-
-	defer authConn.Close()
-
-	_, err = io.Copy(loadingText, authConn)
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to read authentication response: %w", err)
+	if !offline && transcript == nil {
+		player, err = client.New(clientConfig)
+		check.Fatal("failed to start client", err)
 	}
 
-	time.Sleep(time.Second)
-
-	return conn, nil
-}
-
-func makeRequest[R game.Result](conn net.Conn, req game.Request) (res R, err error) {
-	e := json.NewEncoder(conn)
-	d := json.NewDecoder(conn)
+	log.SetOutput(io.Discard)
 
-	if req.Type == game.RequestGuess {
-		err = e.Encode(req)
-		if err != nil {
-			return nil, err
-		}
+	if transcript != nil {
+		startReplayUI(transcript)
+		return
 	}
 
-	err = d.Decode(&res)
-	if err != nil {
-		return nil, err
+	if *spectate {
+		startSpectatorUI(*spectateSession)
+		return
 	}
 
-	return res, nil
+	startUI()
 }
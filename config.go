@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"pppordle/admin"
+	"pppordle/logging"
+	"pppordle/server/level"
+)
+
+// ServerConfig holds the settings of a server instance. Settings are read from
+// a JSON config file, then PPPORDLE_* environment variables, then flags, each
+// overriding the last.
+type ServerConfig struct {
+	Dev    bool
+	Domain string
+
+	// SessionPort is the port of the session server, levels listen on the
+	// port offsets of the manifest relative to it.
+	SessionPort int
+	// SinglePort serves the levels on the session port as well, see Mux.
+	SinglePort  bool
+	MetricsAddr string
+	AdminSocket string
+
+	LogFile      string
+	LogSeverity  logging.Severity
+	LogSecrets   bool
+	CACert       string
+	CAKey        string
+	Levels       string
+	SessionStore string
+	Scoreboard   string
+	CertRegistry string
+	CRL          string
+	// TranscriptDir is where the transcripts of games are written, none are
+	// kept if empty.
+	TranscriptDir string
+
+	Timeout       Duration
+	AuthTimeout   Duration
+	ResumeWindow  Duration
+	ShutdownGrace Duration
+
+	// BindingValidity is how long the session token handed out on init can
+	// be used to connect to a level.
+	BindingValidity Duration
+
+	// SessionRate and LevelRate limit the connections a minute from an IP or
+	// client certificate, allowing bursts of SessionBurst and LevelBurst. A
+	// rate of 0 disables the limit.
+	SessionRate  float64
+	SessionBurst int
+	LevelRate    float64
+	LevelBurst   int
+
+	ServerCertValidity Duration
+	ClientCertValidity Duration
+
+	// DailySecret derives the words of daily levels. Changing it changes the
+	// puzzle of the day.
+	DailySecret string
+}
+
+// Duration is a time.Duration written as a string, e.g. "1m30s", in config
+// files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func defaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		SessionPort:  1337,
+		MetricsAddr:  "localhost:9137",
+		AdminSocket:  admin.DefaultSocket,
+		LogFile:      "pppordle.log",
+		LogSeverity:  logging.Info,
+		Levels:       "levels.json",
+		Scoreboard:   "scoreboard.json",
+		CertRegistry: "certs/issued.jsonl",
+		CRL:          "certs/revoked.crl",
+
+		Timeout:       Duration{1 * time.Minute},
+		AuthTimeout:   Duration{3 * time.Second},
+		ResumeWindow:  Duration{10 * time.Minute},
+		ShutdownGrace: Duration{30 * time.Second},
+
+		BindingValidity: Duration{30 * time.Second},
+
+		SessionRate:  60,
+		SessionBurst: 10,
+		LevelRate:    20,
+		LevelBurst:   5,
+
+		ServerCertValidity: Duration{365 * 24 * time.Hour},
+		ClientCertValidity: Duration{24 * time.Hour},
+	}
+}
+
+// bind registers a flag for every setting of cfg. Each flag can also be set
+// with the environment variable named after it, e.g. PPPORDLE_SESSION_PORT
+// for -session-port.
+func (cfg *ServerConfig) bind(fs *flag.FlagSet) {
+	fs.BoolVar(&cfg.Dev, "dev", cfg.Dev, "development mode, serving localhost with the dev CA")
+	fs.StringVar(&cfg.Domain, "domain", cfg.Domain, "domain of the server certificate")
+	fs.IntVar(&cfg.SessionPort, "session-port", cfg.SessionPort, "session server port")
+	fs.BoolVar(&cfg.SinglePort, "single-port", cfg.SinglePort, "serve the levels on the session port, routed by ALPN or SNI")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "address to serve metrics on, none are served if empty")
+	fs.StringVar(&cfg.AdminSocket, "admin-socket", cfg.AdminSocket, "admin socket path")
+
+	fs.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "log file path")
+	fs.Var(&cfg.LogSeverity, "log-level", "minimum severity logged: debug, info, warn or error")
+	fs.BoolVar(&cfg.LogSecrets, "log-secrets", cfg.LogSecrets, "log and transcribe secret answers, for debugging only")
+	fs.StringVar(&cfg.CACert, "ca-cert", cfg.CACert, "CA certificate path")
+	fs.StringVar(&cfg.CAKey, "ca-key", cfg.CAKey, "CA key path")
+	fs.StringVar(&cfg.Levels, "levels", cfg.Levels, "level manifest path")
+	fs.StringVar(&cfg.SessionStore, "session-store", cfg.SessionStore, "session store directory, sessions are kept in memory if empty")
+	fs.StringVar(&cfg.Scoreboard, "scoreboard", cfg.Scoreboard, "scoreboard path")
+	fs.StringVar(&cfg.CertRegistry, "cert-registry", cfg.CertRegistry, "issued certificate registry path")
+	fs.StringVar(&cfg.CRL, "crl", cfg.CRL, "certificate revocation list path")
+	fs.StringVar(&cfg.TranscriptDir, "transcript-dir", cfg.TranscriptDir, "directory game transcripts are written to, none are kept if empty")
+
+	fs.DurationVar(&cfg.Timeout.Duration, "timeout", cfg.Timeout.Duration, "session connection timeout")
+	fs.DurationVar(&cfg.AuthTimeout.Duration, "auth-timeout", cfg.AuthTimeout.Duration, "time a session has to authenticate with a level")
+	fs.DurationVar(&cfg.ResumeWindow.Duration, "resume-window", cfg.ResumeWindow.Duration, "time a dropped session can be resumed in")
+	fs.DurationVar(&cfg.ShutdownGrace.Duration, "shutdown-grace", cfg.ShutdownGrace.Duration, "time games have to finish on shutdown")
+	fs.DurationVar(&cfg.BindingValidity.Duration, "binding-validity", cfg.BindingValidity.Duration, "time a session token can be used to connect to a level")
+
+	fs.Float64Var(&cfg.SessionRate, "session-rate", cfg.SessionRate, "session connections a minute allowed per IP, 0 for no limit")
+	fs.IntVar(&cfg.SessionBurst, "session-burst", cfg.SessionBurst, "session connections allowed per IP in a burst")
+	fs.Float64Var(&cfg.LevelRate, "level-rate", cfg.LevelRate, "level connections a minute allowed per IP and client certificate, 0 for no limit")
+	fs.IntVar(&cfg.LevelBurst, "level-burst", cfg.LevelBurst, "level connections allowed per IP and client certificate in a burst")
+
+	fs.DurationVar(&cfg.ServerCertValidity.Duration, "server-cert-validity", cfg.ServerCertValidity.Duration, "validity of the server certificate")
+	fs.DurationVar(&cfg.ClientCertValidity.Duration, "client-cert-validity", cfg.ClientCertValidity.Duration, "validity of level client certificates")
+
+	fs.StringVar(&cfg.DailySecret, "daily-secret", cfg.DailySecret, "secret deriving the words of daily levels")
+}
+
+// LoadServerConfig builds the config from the config file, environment and
+// flags in args, returning the arguments left after the flags. Invalid flags
+// exit the process.
+func LoadServerConfig(args []string) (*ServerConfig, []string, error) {
+	// The flags are parsed twice, first to find the config file and then to
+	// override the settings read from it. Flag errors are reported by the
+	// second pass.
+	var configPath string
+	pre := flag.NewFlagSet("server", flag.ContinueOnError)
+	pre.SetOutput(io.Discard)
+	pre.StringVar(&configPath, "config", os.Getenv("PPPORDLE_CONFIG"), "JSON config file")
+	defaultServerConfig().bind(pre)
+	pre.Parse(args)
+
+	cfg := defaultServerConfig()
+	if configPath != "" {
+		f, err := os.Open(configPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid config file %s: %w", configPath, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	fs.String("config", configPath, "JSON config file")
+	cfg.bind(fs)
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if ok && envErr == nil {
+			envErr = fs.Set(f.Name, value)
+			if envErr != nil {
+				envErr = fmt.Errorf("invalid %s: %w", envName(f.Name), envErr)
+			}
+		}
+	})
+	if envErr != nil {
+		return nil, nil, envErr
+	}
+	if os.Getenv("PPPORDLE_ENV") == "dev" {
+		cfg.Dev = true
+	}
+
+	fs.Parse(args)
+
+	return cfg, fs.Args(), cfg.resolve()
+}
+
+func envName(flagName string) string {
+	return "PPPORDLE_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// resolve fills in the settings which default differently in development
+// mode and checks the config.
+func (cfg *ServerConfig) resolve() error {
+	certName := "ca"
+	domain := "pppordle.chal.pwni.ng"
+	if cfg.Dev {
+		certName = "dev_ca"
+		domain = "localhost"
+	}
+
+	if cfg.Domain == "" {
+		cfg.Domain = domain
+	}
+	if cfg.CACert == "" {
+		cfg.CACert = fmt.Sprintf("certs/%s.pem", certName)
+	}
+	if cfg.CAKey == "" {
+		cfg.CAKey = fmt.Sprintf("certs/%s.key", certName)
+	}
+
+	if cfg.SessionPort <= 0 || cfg.SessionPort > 65535 {
+		return fmt.Errorf("invalid session port %d", cfg.SessionPort)
+	}
+	if cfg.ServerCertValidity.Duration < time.Second || cfg.ClientCertValidity.Duration < time.Second {
+		return errors.New("certificate validity must be at least a second")
+	}
+	if cfg.SessionRate < 0 || cfg.LevelRate < 0 {
+		return errors.New("connection rates can't be negative")
+	}
+	if cfg.SessionRate > 0 && cfg.SessionBurst < 1 || cfg.LevelRate > 0 && cfg.LevelBurst < 1 {
+		return errors.New("rate limited connections need a burst of at least 1")
+	}
+
+	return nil
+}
+
+// Daily returns the word picker of daily levels, nil without a daily secret.
+func (cfg *ServerConfig) Daily() *level.Daily {
+	if cfg.DailySecret == "" {
+		return nil
+	}
+
+	return &level.Daily{Secret: []byte(cfg.DailySecret)}
+}
+
+// LevelPort is the port of the level with the given port offset.
+func (cfg *ServerConfig) LevelPort(offset int) int {
+	if cfg.SinglePort {
+		return cfg.SessionPort
+	}
+
+	return cfg.SessionPort + offset
+}
@@ -0,0 +1,34 @@
+package level
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DailyEpoch is the day of puzzle #1.
+var DailyEpoch = time.Date(2022, time.April, 8, 0, 0, 0, 0, time.UTC)
+
+// Daily picks the words of daily levels. The word of a day is derived from
+// the date and a server secret, so every player gets the same puzzle until
+// midnight UTC and the next ones can't be predicted without the secret.
+type Daily struct {
+	Secret []byte
+}
+
+// Puzzle returns the number of the puzzle of the day of t.
+func (d *Daily) Puzzle(t time.Time) int {
+	return int(t.UTC().Sub(DailyEpoch).Hours()/24) + 1
+}
+
+// rand returns the random source of a level on the given puzzle.
+func (d *Daily) rand(level, puzzle int) *rand.Rand {
+	mac := hmac.New(sha256.New, d.Secret)
+	fmt.Fprintf(mac, "level %d puzzle %d", level, puzzle)
+	seed := binary.BigEndian.Uint64(mac.Sum(nil))
+
+	return rand.New(rand.NewSource(int64(seed)))
+}
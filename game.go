@@ -2,6 +2,8 @@ package game
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"pppordle/cert"
 
@@ -9,7 +11,8 @@ import (
 )
 
 type Result interface {
-	*GuessResult | *InfoResult | *InitResult
+	*GuessResult | *InfoResult | *InitResult | *CatalogResult | *SpectatorEvent | *LeaderboardResult
+	MessageType() MessageType
 }
 
 type GuessValidator func(game *Game, guess []rune) error
@@ -20,19 +23,39 @@ const (
 	RequestInfo = iota
 	RequestGuess
 	RequestInit
+	RequestCatalog
+	RequestResume
+	RequestSpectate
+	RequestLeaderboard
+	// RequestKeepalive keeps a spectator stream open while no games are
+	// played, it has no response.
+	RequestKeepalive
 )
 
 type Game struct {
-	Word       []rune
-	Guesses    int
-	Validator  GuessValidator
-	Level      int
-	Candidates []rune
+	Word            []rune
+	Guesses         int
+	Validator       GuessValidator `json:"-"`
+	Level           int
+	Candidates      []string
 	CompleteMessage string
+	HardMode        bool
+	History         []GuessRecord
+	Puzzle          int // number of the daily puzzle, 0 outside daily levels
+	Separators      []rune
+	Graphemes       bool // letters are grapheme clusters, see SplitLetters
+	NoHints         bool
+}
+
+// GuessRecord is a scored guess of a game.
+type GuessRecord struct {
+	Guess      string
+	Indicators []rune
 }
 
 type GuessResult struct {
 	Error            string
+	Violation        *Violation
 	Indicators       []rune
 	Complete         bool
 	CompleteMessage  string
@@ -45,12 +68,75 @@ type InfoResult struct {
 	Length     int
 	Level      int
 	Guesses    int
-	Candidates []rune
+	Candidates []string
+	HardMode   bool
+	History    []GuessRecord
+	Puzzle     int
+	// Separators holds the separator of every cell, 0 for the letters to
+	// guess, or is empty when the word has none.
+	Separators []rune
+	// Graphemes is set when letters are grapheme clusters rather than
+	// runes.
+	Graphemes bool
+	// NoHints asks the client not to offer hints for the level.
+	NoHints bool
+	// Result is the result of the last guess once the game is over, sent
+	// again when a finished game is resumed.
+	Result *GuessResult
 }
 
 type InitResult struct {
-	SessionID  uuid.UUID
-	LevelCount int
+	SessionID   uuid.UUID
+	ResumeToken string
+	// BindingToken is sent as the first line of a level connection to link
+	// it to the session.
+	BindingToken string
+	LevelCount   int
+}
+
+type LevelInfo struct {
+	Number       int
+	Name         string
+	Description  string
+	Port         int
+	Length       int
+	AlphabetSize int
+	Entrypoint   bool
+	HardMode     bool
+	Daily        bool
+	// Unlocked is set by the client when it holds a valid certificate for
+	// the level, it is never sent by the server.
+	Unlocked bool
+}
+
+type CatalogResult struct {
+	Error  string
+	Levels []LevelInfo
+}
+
+// SpectatorEvent reports the progress of a game to spectators. Guesses are
+// never included, only their indicators.
+type SpectatorEvent struct {
+	SessionID        uuid.UUID
+	Level            int
+	Length           int
+	Guesses          int
+	Indicators       []rune
+	RemainingGuesses int
+	Complete         bool
+}
+
+type LeaderboardEntry struct {
+	Rank      int
+	Player    string
+	Levels    int
+	Guesses   int
+	SolveTime time.Duration
+}
+
+type LeaderboardResult struct {
+	Error   string
+	Entries []LeaderboardEntry
 }
 
 type Request struct {
@@ -58,12 +144,34 @@ type Request struct {
 	Data string
 }
 
+// ResumeData formats the data of a RequestResume request.
+func ResumeData(sessionID uuid.UUID, token string) string {
+	return sessionID.String() + ":" + token
+}
+
+func ParseResumeData(data string) (uuid.UUID, string, error) {
+	id, token, ok := strings.Cut(data, ":")
+	if !ok {
+		return uuid.UUID{}, "", errors.New("improperly formatted resume request")
+	}
+
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+
+	return sessionID, token, nil
+}
+
 func (g *Game) ProcessGuess(guess []rune) *GuessResult {
-	if len(guess) != len(g.Word) {
+	word := g.Letters(g.Word)
+	letters, ok := g.expandGuess(word, g.Letters(guess))
+	if !ok {
 		return &GuessResult{
 			Error: errors.New("Invalid Guess").Error(),
 		}
 	}
+	guess = []rune(strings.Join(letters, ""))
 
 	err := g.Validator(g, guess)
 	if err != nil {
@@ -72,50 +180,88 @@ func (g *Game) ProcessGuess(guess []rune) *GuessResult {
 		}
 	}
 
-	count := 0
-	runesLeft := make([]rune, len(g.Word))
-	_ = copy(runesLeft, g.Word)
+	if g.HardMode {
+		violation := g.checkHardMode(letters)
+		if violation != nil {
+			return &GuessResult{
+				Error:     violation.Error(),
+				Violation: violation,
+			}
+		}
+	}
+
+	indicators := g.score(word, letters)
+	greens := 0
+	for _, indicator := range indicators {
+		if indicator == '🟩' {
+			greens++
+		}
+	}
+
+	g.History = append(g.History, GuessRecord{
+		Guess:      string(guess),
+		Indicators: indicators,
+	})
+
+	return &GuessResult{
+		Error:      "",
+		Indicators: indicators,
+		Complete:   greens == g.letterCount(word),
+	}
+}
+
+// Score returns the indicators of guess against word, both split into
+// letters. The indicator of a separator is the separator itself.
+func Score(word, guess []string, separators []rune) []rune {
+	g := Game{Separators: separators}
+	return g.score(word, guess)
+}
+
+func (g *Game) score(word, guess []string) []rune {
+	var lettersLeft []string
+	for _, l := range word {
+		if !g.isSeparator(l) {
+			lettersLeft = append(lettersLeft, l)
+		}
+	}
 	var indicators []rune
-	for i, guessRune := range guess {
-		if guessRune == g.Word[i] {
-			runesLeft = removeFromRunesLeft(runesLeft, guessRune)
+	for i, l := range guess {
+		if g.isSeparator(l) {
+			indicators = append(indicators, []rune(l)[0])
+		} else if l == word[i] {
+			lettersLeft = removeFromLettersLeft(lettersLeft, l)
 			indicators = append(indicators, '🟩')
-			count += 1
 		} else {
 			indicators = append(indicators, '⬛')
 		}
 	}
 
-	for i, guessRune := range guess {
-		if guessRune == g.Word[i] {
+	for i, l := range guess {
+		if l == word[i] || g.isSeparator(l) {
 			continue
-		} else if wordContainsRune(runesLeft, guessRune) > 0 {
-			runesLeft = removeFromRunesLeft(runesLeft, guessRune)
+		} else if countLetter(lettersLeft, l) > 0 {
+			lettersLeft = removeFromLettersLeft(lettersLeft, l)
 			indicators[i] = '🟨'
 		}
 	}
 
-	return &GuessResult{
-		Error:      "",
-		Indicators: indicators,
-		Complete:   count == len(g.Word),
-	}
+	return indicators
 }
 
-func removeFromRunesLeft(runesLeft []rune, guessRune rune) []rune {
-	for i, r := range runesLeft {
-		if guessRune == r {
-			return append(runesLeft[:i], runesLeft[i+1:]...)
+func removeFromLettersLeft(lettersLeft []string, letter string) []string {
+	for i, l := range lettersLeft {
+		if letter == l {
+			return append(lettersLeft[:i], lettersLeft[i+1:]...)
 		}
 	}
 
-	return runesLeft
+	return lettersLeft
 }
 
-func wordContainsRune(word []rune, guess rune) int {
+func countLetter(word []string, letter string) int {
 	count := 0
-	for _, r := range word {
-		if guess == r {
+	for _, l := range word {
+		if letter == l {
 			count++
 		}
 	}
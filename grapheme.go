@@ -0,0 +1,33 @@
+package game
+
+import "github.com/rivo/uniseg"
+
+// SplitLetters splits word into the letters it is played with. Letters are
+// runes, or extended grapheme clusters if graphemes is set, so that a base
+// with combining marks, a ZWJ emoji sequence or a flag is a single letter.
+func SplitLetters(word string, graphemes bool) []string {
+	var letters []string
+	if !graphemes {
+		for _, r := range word {
+			letters = append(letters, string(r))
+		}
+		return letters
+	}
+
+	clusters := uniseg.NewGraphemes(word)
+	for clusters.Next() {
+		letters = append(letters, clusters.Str())
+	}
+
+	return letters
+}
+
+// Letters splits word into the letters of g.
+func (g *Game) Letters(word []rune) []string {
+	return SplitLetters(string(word), g.Graphemes)
+}
+
+// Length returns the number of letters of the word of g.
+func (g *Game) Length() int {
+	return len(g.Letters(g.Word))
+}
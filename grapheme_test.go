@@ -0,0 +1,65 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLetters(t *testing.T) {
+	tests := []struct {
+		name      string
+		word      string
+		graphemes bool
+		letters   []string
+	}{
+		{"runes", "CAFE", false, []string{"C", "A", "F", "E"}},
+		{"combining mark as runes", "CAFÉ", false, []string{"C", "A", "F", "E", "́"}},
+		{"combining mark", "CAFÉ", true, []string{"C", "A", "F", "É"}},
+		{"precomposed", "CAFÉ", true, []string{"C", "A", "F", "É"}},
+		{"ZWJ sequence", "👨‍👩‍👧🐶", true, []string{"👨‍👩‍👧", "🐶"}},
+		{"flags", "🇫🇷🇩🇪", true, []string{"🇫🇷", "🇩🇪"}},
+		{"empty", "", true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			letters := SplitLetters(test.word, test.graphemes)
+			if !reflect.DeepEqual(letters, test.letters) {
+				t.Errorf("SplitLetters(%q, %v) = %q, want %q", test.word, test.graphemes, letters, test.letters)
+			}
+		})
+	}
+}
+
+func TestScoreGraphemes(t *testing.T) {
+	tests := []struct {
+		name       string
+		word       string
+		guess      string
+		indicators string
+	}{
+		{"same clusters", "CAFÉ", "CAFÉ", "🟩🟩🟩🟩"},
+		{"base letter without its mark", "CAFÉ", "CAFE", "🟩🟩🟩⬛"},
+		{"cluster moved", "ÉTE", "TÉE", "🟨🟨🟩"},
+		{"flags swapped", "🇫🇷🇩🇪", "🇩🇪🇫🇷", "🟨🟨"},
+		{"part of a ZWJ sequence", "👨‍👩‍👧🐶", "👨🐶", "⬛🟩"},
+		{"ZWJ sequence moved", "👨‍👩‍👧🐶", "🐶👨‍👩‍👧", "🟨🟨"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Game{
+				Word:      []rune(test.word),
+				Guesses:   6,
+				Graphemes: true,
+				Validator: func(g *Game, guess []rune) error { return nil },
+			}
+
+			result := g.ProcessGuess([]rune(test.guess))
+			if string(result.Indicators) != test.indicators {
+				t.Errorf("guess %q of %q scored %s (%s), want %s",
+					test.guess, test.word, string(result.Indicators), result.Error, test.indicators)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package game
+
+import "fmt"
+
+type ViolationKind string
+
+const (
+	// ViolationGreen is a revealed letter which was not kept in place.
+	ViolationGreen ViolationKind = "green"
+	// ViolationYellow is a revealed letter which was left out.
+	ViolationYellow ViolationKind = "yellow"
+)
+
+// Violation describes the hard mode constraint a guess broke.
+type Violation struct {
+	Kind     ViolationKind
+	Position int
+	Letter   string
+	Count    int
+}
+
+func (v *Violation) Error() string {
+	if v.Kind == ViolationGreen {
+		return fmt.Sprintf("Letter %d must be %s", v.Position+1, v.Letter)
+	}
+
+	if v.Count > 1 {
+		return fmt.Sprintf("Guess must contain %s %d times", v.Letter, v.Count)
+	}
+	return fmt.Sprintf("Guess must contain %s", v.Letter)
+}
+
+// checkHardMode checks that a guess reuses every hint revealed by the previous
+// guesses of the game.
+func (g *Game) checkHardMode(guess []string) *Violation {
+	for _, record := range g.History {
+		previous := g.Letters([]rune(record.Guess))
+		required := make(map[string]int)
+
+		for i, indicator := range record.Indicators {
+			switch indicator {
+			case '🟩':
+				if guess[i] != previous[i] {
+					return &Violation{
+						Kind:     ViolationGreen,
+						Position: i,
+						Letter:   previous[i],
+					}
+				}
+				required[previous[i]]++
+			case '🟨':
+				required[previous[i]]++
+			}
+		}
+
+		for i, indicator := range record.Indicators {
+			if indicator != '🟨' {
+				continue
+			}
+
+			letter := previous[i]
+			if countLetter(guess, letter) < required[letter] {
+				return &Violation{
+					Kind:     ViolationYellow,
+					Position: -1,
+					Letter:   letter,
+					Count:    required[letter],
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckHardMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		previous  []string
+		guess     string
+		violation *Violation
+		message   string
+	}{
+		{
+			name:  "no previous guess",
+			guess: "XXXXX",
+		},
+		{
+			name:     "greens kept",
+			previous: []string{"ABBOT"},
+			guess:    "ABBEY",
+		},
+		{
+			name:      "green moved",
+			previous:  []string{"ABBOT"},
+			guess:     "XBBEY",
+			violation: &Violation{Kind: ViolationGreen, Position: 0, Letter: "A"},
+			message:   "Letter 1 must be A",
+		},
+		{
+			name:     "yellows moved",
+			previous: []string{"BEAST"},
+			guess:    "ABBEY",
+		},
+		{
+			name:      "yellow left out",
+			previous:  []string{"BEAST"},
+			guess:     "AXXEY",
+			violation: &Violation{Kind: ViolationYellow, Position: -1, Letter: "B", Count: 1},
+			message:   "Guess must contain B",
+		},
+		{
+			name:     "repeated letter kept",
+			previous: []string{"BOBBY"},
+			guess:    "XBBEY",
+		},
+		{
+			name:      "repeated letter used once",
+			previous:  []string{"BOBBY"},
+			guess:     "AEBXY",
+			violation: &Violation{Kind: ViolationYellow, Position: -1, Letter: "B", Count: 2},
+			message:   "Guess must contain B 2 times",
+		},
+		{
+			name:      "earlier guess checked too",
+			previous:  []string{"ABBOT", "BEAST"},
+			guess:     "ABBXY",
+			violation: &Violation{Kind: ViolationYellow, Position: -1, Letter: "E", Count: 1},
+			message:   "Guess must contain E",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Game{Word: []rune("ABBEY")}
+			for _, previous := range test.previous {
+				g.History = append(g.History, GuessRecord{
+					Guess:      previous,
+					Indicators: g.score(g.Letters(g.Word), g.Letters([]rune(previous))),
+				})
+			}
+
+			violation := g.checkHardMode(g.Letters([]rune(test.guess)))
+			if !reflect.DeepEqual(violation, test.violation) {
+				t.Fatalf("checkHardMode(%q) = %+v, want %+v", test.guess, violation, test.violation)
+			}
+			if violation != nil && violation.Error() != test.message {
+				t.Errorf("violation message = %q, want %q", violation.Error(), test.message)
+			}
+		})
+	}
+}
+
+func TestProcessGuessHardMode(t *testing.T) {
+	g := &Game{
+		Word:      []rune("ABBEY"),
+		Guesses:   6,
+		HardMode:  true,
+		Validator: func(g *Game, guess []rune) error { return nil },
+	}
+
+	result := g.ProcessGuess([]rune("ABBOT"))
+	if len(result.Indicators) == 0 {
+		t.Fatalf("first guess rejected: %s", result.Error)
+	}
+
+	result = g.ProcessGuess([]rune("XBBEY"))
+	if result.Violation == nil || result.Error == "" || len(result.Indicators) != 0 {
+		t.Fatalf("guess breaking hard mode scored: %+v", result)
+	}
+	if len(g.History) != 1 {
+		t.Errorf("rejected guess recorded, history has %d guesses", len(g.History))
+	}
+}
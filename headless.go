@@ -0,0 +1,536 @@
+// Package client plays pppordle without the terminal UI, for solvers, load
+// testers and integration tests.
+//
+//	c, err := client.New(client.DefaultConfig(false))
+//	...
+//	err = c.Connect(1)
+//	info, err := c.Info()
+//	result, err := c.Guess("CRANE")
+//	if result.Complete {
+//		err = c.SaveCert("certs")
+//	}
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/cert"
+	"pppordle/game"
+)
+
+var ErrNoCert = errors.New("no level completion certificate to save")
+
+// spectatorKeepalive is how often a spectator stream tells the server it is
+// still watching, well within the server's connection timeout.
+const spectatorKeepalive = 20 * time.Second
+
+// Config says which server to play on and where certificates are kept.
+type Config struct {
+	Domain      string
+	SessionPort int
+	CACert      string
+	// CertDir holds the level client certificates, as levelN.pem and
+	// levelN.key, and the organiser certificate spectating needs, as
+	// spectator.pem and spectator.key.
+	CertDir string
+	// Handle is the name shown on the leaderboard.
+	Handle string
+}
+
+// DefaultConfig returns the config of the public server, or of a local
+// development server if dev is set.
+func DefaultConfig(dev bool) Config {
+	if dev {
+		return Config{
+			Domain:      "localhost",
+			SessionPort: 1337,
+			CACert:      "certs/dev_ca.pem",
+			CertDir:     "certs",
+		}
+	}
+
+	return Config{
+		Domain:      "pppordle.chal.pwni.ng",
+		SessionPort: 1337,
+		CACert:      "certs/ca.pem",
+		CertDir:     "certs",
+	}
+}
+
+// Client plays one game at a time. Catalog, Leaderboard and Spectate use
+// sessions of their own and can be called at any time.
+type Client struct {
+	Config Config
+
+	// Progress receives the messages of the level server while Connect
+	// authenticates, e.g. "Searching for session...".
+	Progress io.Writer
+	// Shutdown is called with the notices of a server shutting down.
+	Shutdown func(notice *game.ShutdownNotice)
+
+	caCertPool *x509.CertPool
+	requestID  uint64
+
+	conn    *sessionConn
+	init    *game.InitResult
+	guesses int
+	cert    cert.PemCertPair
+}
+
+// sessionConn is a connection to the session server. All its messages go
+// through one encoder and decoder, as a decoder buffers what it reads ahead of
+// the message it decodes.
+type sessionConn struct {
+	net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func newSessionConn(conn net.Conn) *sessionConn {
+	return &sessionConn{
+		Conn:    conn,
+		encoder: json.NewEncoder(conn),
+		decoder: json.NewDecoder(conn),
+	}
+}
+
+func New(config Config) (*Client, error) {
+	ca, err := os.ReadFile(config.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CA cert file: %w", err)
+	}
+	caCertPool := x509.NewCertPool()
+	ok := caCertPool.AppendCertsFromPEM(ca)
+	if !ok {
+		return nil, errors.New("Failed to add ca cert to pool")
+	}
+
+	return &Client{
+		Config:     config,
+		Progress:   io.Discard,
+		Shutdown:   func(notice *game.ShutdownNotice) {},
+		caCertPool: caCertPool,
+	}, nil
+}
+
+// SessionID returns the session of the current game.
+func (c *Client) SessionID() uuid.UUID {
+	if c.init == nil {
+		return uuid.Nil
+	}
+
+	return c.init.SessionID
+}
+
+func (c *Client) tlsConfig(protocol string) *tls.Config {
+	return &tls.Config{
+		RootCAs:    c.caCertPool,
+		NextProtos: []string{protocol},
+	}
+}
+
+// dial starts a new session, presenting certificates to the server if any
+// are given.
+func (c *Client) dial(certificates ...tls.Certificate) (*sessionConn, *game.InitResult, error) {
+	sessionServer := net.JoinHostPort(c.Config.Domain, fmt.Sprint(c.Config.SessionPort))
+
+	tlsConfig := c.tlsConfig(game.SessionProtocol)
+	tlsConfig.Certificates = certificates
+	tlsConn, err := tls.Dial("tcp", sessionServer, tlsConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to session server: %w", err)
+	}
+	conn := newSessionConn(tlsConn)
+
+	initResult, err := request[*game.InitResult](c, conn, game.Request{
+		Type: game.RequestInit,
+		Data: c.Config.Handle,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to get session init result: %w", err)
+	}
+
+	return conn, initResult, nil
+}
+
+// query makes a single request on a new session.
+func query[R game.Result](c *Client, req game.Request) (R, error) {
+	conn, _, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return request[R](c, conn, req)
+}
+
+func (c *Client) Leaderboard() (*game.LeaderboardResult, error) {
+	leaderboard, err := query[*game.LeaderboardResult](c, game.Request{Type: game.RequestLeaderboard})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+	if len(leaderboard.Error) != 0 {
+		return nil, errors.New(leaderboard.Error)
+	}
+
+	return leaderboard, nil
+}
+
+// Catalog returns the levels of the server, marking those the client holds a
+// certificate for as unlocked.
+func (c *Client) Catalog() (*game.CatalogResult, error) {
+	catalog, err := query[*game.CatalogResult](c, game.Request{Type: game.RequestCatalog})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get level catalog: %w", err)
+	}
+	if len(catalog.Error) != 0 {
+		return nil, errors.New(catalog.Error)
+	}
+
+	for i, l := range catalog.Levels {
+		catalog.Levels[i].Unlocked = l.Entrypoint || c.CertValid(l.Number)
+	}
+
+	return catalog, nil
+}
+
+func (c *Client) certPath(level int, ext string) string {
+	return filepath.Join(c.Config.CertDir, fmt.Sprintf("level%d.%s", level, ext))
+}
+
+// CertValid reports whether the client certificate stored for a level is
+// signed by the CA, unexpired and issued for that level.
+func (c *Client) CertValid(level int) bool {
+	clientPem, err := os.ReadFile(c.certPath(level, "pem"))
+	if err != nil {
+		return false
+	}
+
+	block, _ := pem.Decode(clientPem)
+	if block == nil {
+		return false
+	}
+	clientCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	_, err = clientCert.Verify(x509.VerifyOptions{
+		DNSName:   fmt.Sprint(level),
+		Roots:     c.caCertPool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+// Connect starts a game of a level, looking it up in the catalog.
+func (c *Client) Connect(level int) error {
+	catalog, err := c.Catalog()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range catalog.Levels {
+		if l.Number == level {
+			return c.ConnectLevel(l)
+		}
+	}
+
+	return fmt.Errorf("unknown level %d", level)
+}
+
+// ConnectLevel starts a game of a level of the catalog. Levels which are not
+// entrypoints need the certificate of the level in the cert directory.
+func (c *Client) ConnectLevel(level game.LevelInfo) error {
+	c.Close()
+
+	tlsConfig := c.tlsConfig(game.LevelProtocol(level.Number))
+	if !level.Entrypoint {
+		clientCert, err := tls.LoadX509KeyPair(c.certPath(level.Number, "pem"), c.certPath(level.Number, "key"))
+		if err != nil {
+			return fmt.Errorf("unable to load client certificate for this level: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	conn, initResult, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	levelServer := net.JoinHostPort(c.Config.Domain, fmt.Sprint(level.Port))
+	authConn, err := tls.Dial("tcp", levelServer, tlsConfig)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connnect to level %d server: %w", level.Number, err)
+	}
+	defer authConn.Close()
+
+	_, err = fmt.Fprintln(authConn, initResult.BindingToken)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send session token: %w", err)
+	}
+
+	_, err = io.Copy(c.Progress, authConn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read authentication response: %w", err)
+	}
+
+	c.conn = conn
+	c.init = initResult
+	c.guesses = 0
+	c.cert = cert.PemCertPair{}
+
+	return nil
+}
+
+// Info returns the state of the current game.
+func (c *Client) Info() (*game.InfoResult, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected to a level")
+	}
+
+	return request[*game.InfoResult](c, c.conn, game.Request{Type: game.RequestInfo})
+}
+
+// Guess scores a guess of the current game. If the connection drops, the
+// session is resumed and the guess sent again unless the server already
+// scored it. Errors of the server are returned as they are.
+func (c *Client) Guess(word string) (*game.GuessResult, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected to a level")
+	}
+
+	req := game.Request{
+		Type: game.RequestGuess,
+		Data: word,
+	}
+
+	result, err := request[*game.GuessResult](c, c.conn, req)
+	if err != nil && !dropped(err) {
+		return nil, err
+	} else if err != nil {
+		var info *game.InfoResult
+		info, err = c.Resume()
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Result != nil {
+			result = info.Result
+		} else if len(info.History) > c.guesses {
+			last := info.History[len(info.History)-1]
+			result = &game.GuessResult{
+				Indicators:       last.Indicators,
+				RemainingGuesses: info.Guesses - len(info.History),
+			}
+		} else {
+			result, err = request[*game.GuessResult](c, c.conn, req)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(result.Error) == 0 {
+		c.guesses++
+	}
+	if result.Complete {
+		c.cert = result.ClientCert
+	}
+
+	return result, nil
+}
+
+// Resume reconnects the session of the current game after its connection
+// dropped.
+func (c *Client) Resume() (*game.InfoResult, error) {
+	if c.init == nil {
+		return nil, errors.New("no session to resume")
+	}
+
+	conn, _, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := request[*game.InfoResult](c, conn, game.Request{
+		Type: game.RequestResume,
+		Data: game.ResumeData(c.init.SessionID, c.init.ResumeToken),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to resume session: %w", err)
+	}
+	if len(info.Error) != 0 {
+		conn.Close()
+		return nil, errors.New(info.Error)
+	}
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = conn
+
+	return info, nil
+}
+
+// SaveCert stores the certificate of the next level, handed out on
+// completing the current game, in dir.
+func (c *Client) SaveCert(dir string) error {
+	if len(c.cert.Cert) == 0 {
+		return ErrNoCert
+	}
+
+	block, _ := pem.Decode(c.cert.Cert)
+	if block == nil {
+		return errors.New("invalid client certificate")
+	}
+	clientCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	if len(clientCert.DNSNames) == 0 {
+		return errors.New("client certificate does not name a level")
+	}
+	level := clientCert.DNSNames[0]
+
+	err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("level%s.pem", level)), c.cert.Cert, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write level %s client certificate: %w", level, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("level%s.key", level)), c.cert.Key, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write level %s client key: %w", level, err)
+	}
+
+	return nil
+}
+
+// Close ends the current game.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Spectate streams game events from the session server until the connection
+// fails. An empty sessionID streams the events of every session. Spectating
+// is for organisers and needs the spectator certificate in the cert
+// directory.
+func (c *Client) Spectate(sessionID string, events chan<- *game.SpectatorEvent) error {
+	spectatorCert, err := tls.LoadX509KeyPair(
+		filepath.Join(c.Config.CertDir, "spectator.pem"),
+		filepath.Join(c.Config.CertDir, "spectator.key"))
+	if err != nil {
+		return fmt.Errorf("unable to load spectator certificate: %w", err)
+	}
+
+	conn, _, err := c.dial(spectatorCert)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	id := atomic.AddUint64(&c.requestID, 1)
+	err = game.WriteMessage(conn.encoder, game.MessageRequest, id, game.Request{
+		Type: game.RequestSpectate,
+		Data: sessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(spectatorKeepalive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			id := atomic.AddUint64(&c.requestID, 1)
+			err := game.WriteMessage(conn.encoder, game.MessageRequest, id, game.Request{Type: game.RequestKeepalive})
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		envelope, err := game.ReadMessage(conn.decoder)
+		if err != nil {
+			return fmt.Errorf("spectator stream failed: %w", err)
+		}
+
+		if envelope.Type == game.MessageShutdown {
+			return errors.New("Server shutting down")
+		}
+
+		event, err := game.DecodeResult[*game.SpectatorEvent](envelope, id)
+		if err != nil {
+			return err
+		}
+
+		events <- event
+	}
+}
+
+// dropped reports whether err means the connection to the server was lost,
+// rather than the server refusing a request.
+func dropped(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+func request[R game.Result](c *Client, conn *sessionConn, req game.Request) (res R, err error) {
+	id := atomic.AddUint64(&c.requestID, 1)
+	err = game.WriteMessage(conn.encoder, game.MessageRequest, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		envelope, err := game.ReadMessage(conn.decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		if envelope.Type == game.MessageShutdown {
+			notice, err := game.DecodeShutdown(envelope)
+			if err != nil {
+				return nil, err
+			}
+			c.Shutdown(notice)
+			continue
+		}
+
+		return game.DecodeResult[R](envelope, id)
+	}
+}
@@ -1,59 +1,149 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
-	"pppordle/check"
+	"pppordle/admin"
+	"pppordle/cert"
+	"pppordle/game"
+	"pppordle/logging"
+	"pppordle/ratelimit"
 	"pppordle/server/level"
-
-	"github.com/google/uuid"
 )
 
-var (
-	Requests     = make(map[Conn]*uuid.UUID)
-	RequestMutex sync.Mutex
-)
+// bindingReadTimeout is how long a level connection has to present its
+// session token after the handshake.
+const bindingReadTimeout = 5 * time.Second
 
 type LevelServer struct {
 	Port       int
 	Config     *tls.Config
-	Level      *level.Level
+	Number     int
 	Entrypoint bool
+	Limiter    *ratelimit.Limiter
+	Log        *logging.Logger
+
+	mutex sync.RWMutex
+	level *level.Level
+	info  game.LevelInfo
+
+	pendingMutex sync.Mutex
+	pending      map[net.Conn]admin.LevelRequest
+}
+
+func (ls *LevelServer) Level() *level.Level {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	return ls.level
+}
+
+func (ls *LevelServer) Info() game.LevelInfo {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	return ls.info
+}
+
+// SetLevel swaps the level served, games already in progress are unaffected.
+func (ls *LevelServer) SetLevel(l *level.Level, info game.LevelInfo) {
+	ls.mutex.Lock()
+	ls.level = l
+	ls.info = info
+	ls.mutex.Unlock()
+}
+
+// Pending lists the connections waiting to be linked to their session.
+func (ls *LevelServer) Pending() []admin.LevelRequest {
+	ls.pendingMutex.Lock()
+	defer ls.pendingMutex.Unlock()
+
+	var pending []admin.LevelRequest
+	for _, r := range ls.pending {
+		pending = append(pending, r)
+	}
+
+	return pending
+}
+
+func (ls *LevelServer) setPending(conn net.Conn, r *admin.LevelRequest) {
+	ls.pendingMutex.Lock()
+	defer ls.pendingMutex.Unlock()
+
+	if r == nil {
+		delete(ls.pending, conn)
+		return
+	}
+
+	if ls.pending == nil {
+		ls.pending = make(map[net.Conn]admin.LevelRequest)
+	}
+	ls.pending[conn] = *r
 }
 
-func (ls *LevelServer) Host() {
+// Host listens on the port of the level until ctx is cancelled.
+func (ls *LevelServer) Host(ctx context.Context) error {
 	listener, err := tls.Listen("tcp", fmt.Sprintf(":%d", ls.Port), ls.Config)
-	check.Fatal(fmt.Sprintf("level %d listener failed", ls.Level.Number), err)
+	if err != nil {
+		return err
+	}
+
+	return ls.Serve(ctx, listener)
+}
+
+// Serve accepts level connections from listener until ctx is cancelled.
+func (ls *LevelServer) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			check.Print("error accepting connection", err)
+			if ctx.Err() != nil {
+				return nil
+			}
+			ls.Log.Warn("level.accept", "error accepting connection", "error", err)
 			continue
 		}
 
+		levelConnections.Inc(levelLabel(ls.Number))
 		go ls.HandleAuthenticatedRequest(conn)
 	}
 }
 
 func (ls *LevelServer) HandleAuthenticatedRequest(conn net.Conn) {
-	sessionConn := Conn{
-		LocalAddr:  conn.LocalAddr(),
-		RemoteAddr: conn.RemoteAddr(),
-	}
-
 	defer func() {
-		RequestMutex.Lock()
-		delete(Requests, sessionConn)
-		RequestMutex.Unlock()
+		ls.setPending(conn, nil)
 		conn.Close()
 	}()
 
+	clientCert, err := handshake(conn)
+	if err != nil {
+		ls.Log.Info("level.handshake", "level handshake failed", "remote", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	token, err := readBindingToken(conn)
+	if err != nil {
+		ls.Log.Info("level.session", "no session token", "remote", conn.RemoteAddr(), "error", err)
+		sessionLookupFailures.Inc(levelLabel(ls.Number), "no_session")
+		conn.Write([]byte("Error finding session:\nNo session provided"))
+		return
+	}
+
 	connErr := make(chan error, 1)
 	sessionErr := make(chan error, 1)
 
@@ -62,7 +152,7 @@ func (ls *LevelServer) HandleAuthenticatedRequest(conn net.Conn) {
 	wg.Add(1)
 
 	go func() {
-		ls.sessionSearch(sessionConn, connErr, sessionErr)
+		ls.sessionSearch(conn, token, clientCert, connErr, sessionErr)
 		wg.Done()
 	}()
 	feedbackWriter(conn, connErr, sessionErr)
@@ -103,24 +193,95 @@ sessionSearchLoop:
 	}
 }
 
-func (ls *LevelServer) sessionSearch(sessionConn Conn, connErr chan error, sessionErr chan error) {
-	var err error
-	bruteForcePrevention(1000)
-
-	RequestMutex.Lock()
-	sessionID, ok := Requests[sessionConn]
-	RequestMutex.Unlock()
+// handshake completes the TLS handshake of a level connection and returns the
+// client certificate, if one was presented.
+func handshake(conn net.Conn) (*x509.Certificate, error) {
+	tlsConn, ok := conn.(*tls.Conn)
 	if !ok {
-		sessionErr <- errors.New("No session provided")
+		return nil, nil
+	}
+
+	err := tlsConn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+
+	peerCerts := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return nil, nil
+	}
+
+	return peerCerts[0], nil
+}
+
+func certFingerprint(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// readBindingToken reads the session token a level connection opens with.
+func readBindingToken(conn net.Conn) (string, error) {
+	err := conn.SetReadDeadline(time.Now().Add(bindingReadTimeout))
+	if err != nil {
+		return "", err
+	}
+
+	line, err := bufio.NewReader(io.LimitReader(conn, 256)).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), conn.SetReadDeadline(time.Time{})
+}
+
+func (ls *LevelServer) sessionSearch(conn net.Conn, token string, clientCert *x509.Certificate, connErr chan error, sessionErr chan error) {
+	var fingerprint, player string
+	if clientCert != nil {
+		fingerprint = certFingerprint(clientCert)
+		player = cert.Player(clientCert)
+	}
+
+	key, retry := ls.Limiter.Allow(rateLimitKeys(conn.RemoteAddr(), fingerprint)...)
+	if key != "" {
+		rateLimited.Inc("level", rateLimitKind(key))
+		ls.Log.Warn("level.rate_limit", "rate limited", "remote", conn.RemoteAddr(), "key", key, "retry", retry)
+		sessionErr <- rateLimitError(retry)
+		return
+	}
+
+	sessionID, err := Bindings.Verify(token)
+	if err != nil {
+		sessionLookupFailures.Inc(levelLabel(ls.Number), "invalid_token")
+		ls.Log.Info("level.session", "invalid session token", "remote", conn.RemoteAddr(), "error", err)
+		sessionErr <- err
 		return
 	}
 
-	session, ok := Sessions[*sessionID]
+	ls.setPending(conn, &admin.LevelRequest{
+		LocalAddr:  conn.LocalAddr().String(),
+		RemoteAddr: conn.RemoteAddr().String(),
+		SessionID:  sessionID,
+	})
+
+	SessionMutex.Lock()
+	session, ok := Sessions[sessionID]
+	SessionMutex.Unlock()
 	if !ok {
+		sessionLookupFailures.Inc(levelLabel(ls.Number), "unknown_session")
+		ls.Log.Info("level.session", "could not find session", "remote", conn.RemoteAddr(), "session", sessionID)
 		sessionErr <- errors.New("Could not find session")
 		return
 	}
 
+	select {
+	case <-session.Playing:
+		sessionLookupFailures.Inc(levelLabel(ls.Number), "has_game")
+		ls.Log.Info("level.session", "session already has a game", "remote", conn.RemoteAddr(), "session", sessionID)
+		sessionErr <- errors.New("Session already has a game")
+		return
+	default:
+	}
+
 	sessionErr <- nil
 	select {
 	case err = <-connErr:
@@ -130,9 +291,47 @@ func (ls *LevelServer) sessionSearch(sessionConn Conn, connErr chan error, sessi
 		return
 	}
 
-	session.GameChan <- ls.Level.GenerateGame()
+	select {
+	case session.GameChan <- &Authentication{
+		Game:   ls.Level().GenerateGame(),
+		Player: player,
+	}:
+	case <-session.Playing:
+	case <-session.Done:
+	}
+}
+
+// newLimiter creates a limiter of perMinute connections, or none if perMinute
+// is 0.
+func newLimiter(perMinute float64, burst int) *ratelimit.Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return ratelimit.New(perMinute, burst)
+}
+
+// rateLimitKeys are the limiter keys of a connection, its IP and the
+// fingerprint of its client certificate if it presented one.
+func rateLimitKeys(addr net.Addr, fingerprint string) []string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	keys := []string{"ip:" + host}
+	if fingerprint != "" {
+		keys = append(keys, "cert:"+fingerprint)
+	}
+
+	return keys
+}
+
+func rateLimitKind(key string) string {
+	kind, _, _ := strings.Cut(key, ":")
+	return kind
 }
 
-func bruteForcePrevention(ms time.Duration) {
-	time.Sleep(ms * time.Millisecond)
+func rateLimitError(retry time.Duration) error {
+	return fmt.Errorf("rate limited, retry in %d s", int(math.Ceil(retry.Seconds())))
 }
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+
+	"pppordle/game"
+)
+
+// Session is a game being played, on a server by a Client or in-process by
+// a Local.
+type Session interface {
+	Info() (*game.InfoResult, error)
+	Guess(word string) (*game.GuessResult, error)
+	SaveCert(dir string) error
+	Close() error
+}
+
+// Local plays a game in-process, without a server, for practice. There is no
+// certificate to save on completion.
+type Local struct {
+	game *game.Game
+}
+
+func NewLocal(g *game.Game) *Local {
+	return &Local{game: g}
+}
+
+func (l *Local) Info() (*game.InfoResult, error) {
+	g := l.game
+	return &game.InfoResult{
+		Length:     g.Length(),
+		Level:      g.Level,
+		Guesses:    g.Guesses,
+		Candidates: g.Candidates,
+		HardMode:   g.HardMode,
+		History:    g.History,
+		Puzzle:     g.Puzzle,
+		Separators: g.SeparatorCells(),
+		Graphemes:  g.Graphemes,
+		NoHints:    g.NoHints,
+	}, nil
+}
+
+// Guess scores a guess like the session server does.
+func (l *Local) Guess(word string) (*game.GuessResult, error) {
+	if len(l.game.History) >= l.game.Guesses {
+		return nil, errors.New("no guesses left")
+	}
+
+	result := l.game.ProcessGuess([]rune(word))
+	result.RemainingGuesses = l.game.Guesses - len(l.game.History)
+	if result.Complete {
+		result.CompleteMessage = l.game.CompleteMessage
+	}
+
+	return result, nil
+}
+
+func (l *Local) SaveCert(dir string) error {
+	return ErrNoCert
+}
+
+func (l *Local) Close() error {
+	return nil
+}
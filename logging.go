@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Severity int
+
+const (
+	Debug Severity = iota
+	Info
+	Warn
+	Error
+)
+
+var severityNames = []string{"debug", "info", "warn", "error"}
+
+func (s Severity) String() string {
+	if s < Debug || s > Error {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(name, n) {
+			return Severity(i), nil
+		}
+	}
+
+	return Info, fmt.Errorf("unknown log severity %q", name)
+}
+
+// Set implements flag.Value.
+func (s *Severity) Set(name string) error {
+	severity, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+
+	*s = severity
+	return nil
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
+
+// Secret is a value, such as the answer of a game, which is only logged when
+// the logger reveals secrets.
+type Secret string
+
+const redacted = "[redacted]"
+
+// Logger writes one JSON object per line. Every line has a time, severity,
+// event type and message, followed by the fields of the logger and of the
+// call.
+type Logger struct {
+	out     *output
+	min     Severity
+	secrets bool
+	fields  []field
+}
+
+type output struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+type field struct {
+	key   string
+	value any
+}
+
+// New creates a logger writing lines of at least severity min to w. Secrets
+// are redacted unless revealSecrets is set.
+func New(w io.Writer, min Severity, revealSecrets bool) *Logger {
+	return &Logger{
+		out:     &output{w: w},
+		min:     min,
+		secrets: revealSecrets,
+	}
+}
+
+// With returns a logger which adds the given key value pairs to every line.
+func (l *Logger) With(kv ...any) *Logger {
+	child := *l
+	child.fields = append(append([]field(nil), l.fields...), pairs(kv)...)
+	return &child
+}
+
+func (l *Logger) Debug(event, msg string, kv ...any) { l.log(Debug, event, msg, kv) }
+func (l *Logger) Info(event, msg string, kv ...any)  { l.log(Info, event, msg, kv) }
+func (l *Logger) Warn(event, msg string, kv ...any)  { l.log(Warn, event, msg, kv) }
+func (l *Logger) Error(event, msg string, kv ...any) { l.log(Error, event, msg, kv) }
+
+// Fatal logs an error and exits.
+func (l *Logger) Fatal(event, msg string, kv ...any) {
+	l.log(Error, event, msg, kv)
+	os.Exit(1)
+}
+
+func pairs(kv []any) []field {
+	var fields []field
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+
+		var value any = "(missing)"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+
+		fields = append(fields, field{key, value})
+	}
+
+	return fields
+}
+
+func (l *Logger) log(severity Severity, event, msg string, kv []any) {
+	if severity < l.min {
+		return
+	}
+
+	fields := append([]field{
+		{"time", time.Now().UTC().Format(time.RFC3339Nano)},
+		{"severity", severity.String()},
+		{"event", event},
+		{"msg", msg},
+	}, l.fields...)
+	fields = append(fields, pairs(kv)...)
+
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(f.key)
+		line.Write(key)
+		line.WriteByte(':')
+
+		value, err := json.Marshal(l.value(f.value))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+
+	l.out.mutex.Lock()
+	l.out.w.Write(line.Bytes())
+	l.out.mutex.Unlock()
+}
+
+// value converts v into something which marshals to readable JSON.
+func (l *Logger) value(v any) any {
+	switch v := v.(type) {
+	case Secret:
+		if l.secrets {
+			return string(v)
+		}
+		return redacted
+	case error:
+		return v.Error()
+	case json.Marshaler, encoding.TextMarshaler:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return v
+}
@@ -0,0 +1,337 @@
+package level
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"pppordle/game"
+)
+
+// Manifest declares the levels hosted by a server, in play order.
+type Manifest struct {
+	Levels []Spec
+}
+
+// Spec declares a single level of a manifest.
+type Spec struct {
+	Number          int
+	Name            string
+	Description     string
+	PortOffset      int
+	Words           string // wordlist, random, cursed or flag
+	WordList        string // wordlist file of answers, the embedded level 1 list if empty
+	AllowedList     string // wordlist file of guesses accepted besides the answers
+	Length          int    // word length of random words, or of the words kept from wordlists
+	Separators      string // letters splitting phrases, revealed up front and not scored
+	Graphemes       bool   // letters are grapheme clusters rather than runes
+	NoHints         bool   // asks clients not to offer hints
+	Alphabet        string // latin, emoji, printable, word or a literal set of letters
+	Guesses         int
+	Validator       string // wordlist, alphabet, exact or flag
+	CompleteMessage string
+	Entrypoint      bool
+	HardMode        bool
+	Daily           bool // same word for every player each day, see Daily
+	Disabled        bool
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read level manifest: %w", err)
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse level manifest: %w", err)
+	}
+
+	numbers := make(map[int]struct{})
+	offsets := make(map[int]struct{})
+	entrypoint := false
+	for _, spec := range manifest.Enabled() {
+		entrypoint = entrypoint || spec.Entrypoint
+
+		if _, ok := numbers[spec.Number]; ok {
+			return nil, fmt.Errorf("level %d declared more than once", spec.Number)
+		}
+		numbers[spec.Number] = struct{}{}
+
+		if spec.PortOffset <= 0 {
+			return nil, fmt.Errorf("level %d: port offset must be positive", spec.Number)
+		}
+		if _, ok := offsets[spec.PortOffset]; ok {
+			return nil, fmt.Errorf("level %d: port offset %d already in use", spec.Number, spec.PortOffset)
+		}
+		offsets[spec.PortOffset] = struct{}{}
+
+		if spec.Guesses <= 0 {
+			return nil, fmt.Errorf("level %d: guesses must be positive", spec.Number)
+		}
+	}
+
+	if len(numbers) == 0 {
+		return nil, errors.New("level manifest has no enabled levels")
+	}
+	if !entrypoint {
+		return nil, errors.New("level manifest has no enabled entrypoint level")
+	}
+
+	return &manifest, nil
+}
+
+// Enabled returns the levels which are not disabled, in manifest order.
+func (m *Manifest) Enabled() []Spec {
+	var specs []Spec
+	for _, spec := range m.Levels {
+		if !spec.Disabled {
+			specs = append(specs, spec)
+		}
+	}
+
+	return specs
+}
+
+// Build creates the level declared by s. daily picks the words of daily
+// levels and may be nil if there are none.
+func (s Spec) Build(daily *Daily) (*Level, error) {
+	if s.Daily && daily == nil {
+		return nil, fmt.Errorf("level %d: daily levels need a daily secret", s.Number)
+	}
+
+	words, source, err := s.loadWords()
+	if err != nil {
+		return nil, fmt.Errorf("level %d: %w", s.Number, err)
+	}
+
+	candidates, err := s.candidates(words)
+	if err != nil {
+		return nil, fmt.Errorf("level %d: %w", s.Number, err)
+	}
+
+	// Separators are not offered as candidates but may appear in guesses.
+	candidateMap := make(map[string]struct{})
+	for _, c := range append(s.letters(s.Separators), candidates...) {
+		candidateMap[c] = struct{}{}
+	}
+
+	wordSource, err := s.wordSource(words, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("level %d: %w", s.Number, err)
+	}
+
+	validator, err := s.validator(wordSource, source, candidateMap)
+	if err != nil {
+		return nil, fmt.Errorf("level %d: %w", s.Number, err)
+	}
+
+	completeMessage := strings.ReplaceAll(s.CompleteMessage, "{flag1}", flag1)
+
+	return &Level{
+		Number: s.Number,
+		GenerateGame: func() *game.Game {
+			g := game.Game{
+				Validator:       validator,
+				Level:           s.Number,
+				Guesses:         s.Guesses,
+				Candidates:      candidates,
+				CompleteMessage: completeMessage,
+				HardMode:        s.HardMode,
+				Separators:      []rune(s.Separators),
+				Graphemes:       s.Graphemes,
+				NoHints:         s.NoHints,
+			}
+
+			intn := rand.Intn
+			if s.Daily {
+				g.Puzzle = daily.Puzzle(time.Now())
+				intn = daily.rand(s.Number, g.Puzzle).Intn
+			}
+
+			g.Word = wordSource.Word(intn)
+
+			return &g
+		},
+	}, nil
+}
+
+// loadWords returns the possible answers of the level along with the raw
+// text they were read from.
+func (s Spec) loadWords() ([][]rune, string, error) {
+	switch s.Words {
+	case "wordlist":
+		source := level1WordlistBytes
+		if s.WordList != "" {
+			data, err := os.ReadFile(s.WordList)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to read wordlist: %w", err)
+			}
+			source = data
+		}
+
+		words, err := game.ReadWords(bytes.NewReader(source), s.Length, s.Graphemes)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read wordlist: %w", err)
+		}
+
+		return words, string(source), nil
+	case "random":
+		return nil, "", nil
+	case "cursed":
+		// Reference: https://stackoverflow.com/a/26722698
+		t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		normalized, _, _ := transform.String(t, level3Word)
+
+		return [][]rune{upper(normalized)}, level3Word, nil
+	case "flag":
+		return [][]rune{upper(flag2)}, flag2, nil
+	}
+
+	return nil, "", fmt.Errorf("unknown word source %q", s.Words)
+}
+
+func (s Spec) wordSource(words [][]rune, candidates []string) (game.WordSource, error) {
+	if s.Words == "random" {
+		if s.Length <= 0 {
+			return nil, errors.New("random words need a positive length")
+		}
+
+		return &game.Generator{Alphabet: candidates, Length: s.Length, Graphemes: s.Graphemes}, nil
+	}
+
+	var guesses [][]rune
+	if s.AllowedList != "" {
+		f, err := os.Open(s.AllowedList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowed guesses: %w", err)
+		}
+		defer f.Close()
+
+		guesses, err = game.ReadWords(f, s.Length, s.Graphemes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowed guesses: %w", err)
+		}
+	}
+
+	return game.NewWordList(words, guesses)
+}
+
+// candidates returns the letters of the alphabet of the level.
+func (s Spec) candidates(words [][]rune) ([]string, error) {
+	var candidates []string
+
+	switch s.Alphabet {
+	case "":
+		return nil, errors.New("no alphabet declared")
+	case "latin":
+		for i := 'A'; i <= 'Z'; i++ {
+			candidates = append(candidates, string(i))
+		}
+	case "emoji":
+		candidates = s.letters(level2ValidEmojis)
+	case "printable":
+		for i := '!'; i <= '~'; i++ {
+			candidates = append(candidates, string(i))
+		}
+	case "word":
+		if len(words) != 1 {
+			return nil, errors.New("word alphabet requires a single word")
+		}
+		candidates = s.letters(string(words[0]))
+	default:
+		candidates = s.letters(s.Alphabet)
+	}
+
+	separators := make(map[string]struct{})
+	for _, separator := range s.letters(s.Separators) {
+		separators[separator] = struct{}{}
+	}
+
+	letters := candidates[:0]
+	for _, c := range candidates {
+		if _, ok := separators[c]; !ok {
+			letters = append(letters, c)
+		}
+	}
+
+	return letters, nil
+}
+
+// letters splits word into the letters of the level.
+func (s Spec) letters(word string) []string {
+	return game.SplitLetters(word, s.Graphemes)
+}
+
+func (s Spec) validator(words game.WordSource, source string, candidateMap map[string]struct{}) (game.GuessValidator, error) {
+	switch s.Validator {
+	case "wordlist":
+		return func(game *game.Game, guess []rune) error {
+			if !ContainsAll(candidateMap, game.Letters(guess)) {
+				return errors.New("Not in character list")
+			}
+
+			if !words.Allowed(guess) {
+				return errors.New("Not in word list")
+			}
+
+			return nil
+		}, nil
+	case "alphabet":
+		return func(game *game.Game, guess []rune) error {
+			if !ContainsAll(candidateMap, game.Letters(guess)) {
+				return errors.New("Not in character list")
+			}
+
+			return nil
+		}, nil
+	case "exact":
+		return func(game *game.Game, guess []rune) error {
+			if string(guess) != source {
+				return errors.New("Not cursed enough")
+			}
+
+			return nil
+		}, nil
+	case "flag":
+		return func(game *game.Game, guess []rune) error {
+			var prefix = []rune{'P', 'C', 'T', 'F', '{'}
+			var suffix = []rune{'}'}
+
+			if len(guess) < len(prefix)+len(suffix) ||
+				!reflect.DeepEqual(prefix, guess[:len(prefix)]) ||
+				!reflect.DeepEqual(suffix, guess[len(guess)-len(suffix):]) {
+				return errors.New("Invalid flag")
+			}
+
+			if !ContainsAll(candidateMap, game.Letters(guess)) {
+				return errors.New("Not in character list")
+			}
+
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown validator %q", s.Validator)
+}
+
+func upper(word string) []rune {
+	var upper []rune
+	for _, l := range word {
+		upper = append(upper, unicode.ToUpper(l))
+	}
+
+	return upper
+}
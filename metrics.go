@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit latencies measured in seconds.
+var DefaultBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+
+// Registry collects metrics and exposes them in the Prometheus text format.
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mutex.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mutex.Unlock()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+}
+
+// vec holds the series of a metric, keyed by their label values.
+type vec[S any] struct {
+	mutex  sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*S
+	values map[string][]string
+	create func() *S
+}
+
+func (v *vec[S]) get(labelValues []string) *S {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d labels, received %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := v.series[key]
+	if !ok {
+		s = v.create()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+
+	return s
+}
+
+func (v *vec[S]) keys() []string {
+	var keys []string
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (v *vec[S]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+}
+
+func (v *vec[S]) labelString(key string, extra ...string) string {
+	var pairs []string
+	for i, value := range v.values[key] {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", v.labels[i], value))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func newVec[S any](name, help, kind string, labels []string, create func() *S) *vec[S] {
+	return &vec[S]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*S),
+		values: make(map[string][]string),
+		create: create,
+	}
+}
+
+// CounterVec counts events, a gauge is a counter which may also go down.
+type CounterVec struct {
+	*vec[float64]
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels, func() *float64 { return new(float64) })}
+	r.register(c)
+	return c
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *CounterVec {
+	g := &CounterVec{newVec(name, help, "gauge", labels, func() *float64 { return new(float64) })}
+	r.register(g)
+	return g
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mutex.Lock()
+	*c.get(labelValues) += delta
+	c.mutex.Unlock()
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Dec(labelValues ...string) {
+	c.Add(-1, labelValues...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.header(w)
+	for _, key := range c.keys() {
+		fmt.Fprintf(w, "%s%s %v\n", c.name, c.labelString(key), *c.series[key])
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec samples observations into cumulative buckets.
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(name, help, "histogram", labels, func() *histogram {
+		return &histogram{counts: make([]uint64, len(buckets))}
+	})
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys() {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatBound(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", h.name, h.labelString(key), s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), s.count)
+	}
+}
+
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+
+	return fmt.Sprint(bound)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pppordle/game"
+	"pppordle/logging"
+)
+
+// muxHandshakeTimeout is how long a connection to the mux has to complete its
+// handshake.
+const muxHandshakeTimeout = 10 * time.Second
+
+// Mux serves the session server and every level on a single port. Clients pick
+// the server with ALPN, or with SNI when they can't, e.g. level2.<domain>.
+// Connections naming neither go to the session server.
+type Mux struct {
+	Port int
+	Log  *logging.Logger
+
+	configs   map[string]*tls.Config
+	listeners map[string]*muxListener
+}
+
+func NewMux(port int, logger *logging.Logger) *Mux {
+	return &Mux{
+		Port:      port,
+		Log:       logger,
+		configs:   make(map[string]*tls.Config),
+		listeners: make(map[string]*muxListener),
+	}
+}
+
+// Listener returns the listener of the connections negotiating protocol,
+// which are handshaken with config.
+func (m *Mux) Listener(protocol string, config *tls.Config) net.Listener {
+	config = config.Clone()
+	config.NextProtos = []string{protocol}
+	m.configs[protocol] = config
+
+	l := &muxListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  &net.TCPAddr{Port: m.Port},
+	}
+	m.listeners[protocol] = l
+
+	return l
+}
+
+// protocol picks the server a client asked for.
+func (m *Mux) protocol(protocols []string, serverName string) string {
+	for _, p := range protocols {
+		if _, ok := m.configs[p]; ok {
+			return p
+		}
+	}
+
+	label, _, _ := strings.Cut(serverName, ".")
+	if number, err := strconv.Atoi(strings.TrimPrefix(label, "level")); err == nil && strings.HasPrefix(label, "level") {
+		return game.LevelProtocol(number)
+	}
+
+	return game.SessionProtocol
+}
+
+func (m *Mux) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	protocol := m.protocol(hello.SupportedProtos, hello.ServerName)
+	config, ok := m.configs[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol %q", protocol)
+	}
+
+	return config, nil
+}
+
+// Serve accepts connections until ctx is cancelled.
+func (m *Mux) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", m.Port))
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		for _, l := range m.listeners {
+			l.Close()
+		}
+	}()
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS13,
+		GetConfigForClient: m.getConfigForClient,
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			m.Log.Warn("mux.accept", "error accepting connection", "error", err)
+			continue
+		}
+
+		go m.route(ctx, tls.Server(conn, config))
+	}
+}
+
+// route hands a connection to the listener of the protocol it negotiated.
+func (m *Mux) route(ctx context.Context, conn *tls.Conn) {
+	ctx, cancel := context.WithTimeout(ctx, muxHandshakeTimeout)
+	defer cancel()
+
+	err := conn.HandshakeContext(ctx)
+	if err != nil {
+		m.Log.Info("mux.handshake", "handshake failed", "remote", conn.RemoteAddr(), "error", err)
+		conn.Close()
+		return
+	}
+
+	state := conn.ConnectionState()
+	protocol := state.NegotiatedProtocol
+	if protocol == "" {
+		protocol = m.protocol(nil, state.ServerName)
+	}
+
+	l, ok := m.listeners[protocol]
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// muxListener is fed the connections routed to one server by the mux.
+type muxListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *muxListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
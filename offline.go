@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"pppordle/game"
+	"pppordle/pkg/client"
+)
+
+// Offline mode plays practice levels in-process, with no server to connect
+// to. The word level picks from the -wordlist words, the letters level from
+// random letters.
+var (
+	offline       bool
+	offlineLength int
+)
+
+const (
+	offlineWords = iota + 1
+	offlineLetters
+)
+
+const offlineGuesses = 6
+
+// offlineMaxLength is the longest word the board can lay out.
+const offlineMaxLength = 50
+
+func init() {
+	rand.Seed(time.Now().UnixMilli())
+}
+
+func offlineAlphabet() []string {
+	var alphabet []string
+	for i := 'A'; i <= 'Z'; i++ {
+		alphabet = append(alphabet, string(i))
+	}
+
+	return alphabet
+}
+
+// offlineGenerator makes up the words of the letters level.
+func offlineGenerator() *game.Generator {
+	return &game.Generator{Alphabet: offlineAlphabet(), Length: offlineLength}
+}
+
+// offlineWordlist returns the words of the -wordlist which can be played
+// offline, the ones the letters level could make up.
+func offlineWordlist() [][]rune {
+	generator := offlineGenerator()
+
+	var words [][]rune
+	for _, w := range hintWords {
+		if generator.Allowed([]rune(w)) {
+			words = append(words, []rune(w))
+		}
+	}
+
+	return words
+}
+
+func offlineCatalog() *game.CatalogResult {
+	letters := game.LevelInfo{
+		Number:       offlineLetters,
+		Name:         "Letters",
+		Description:  "Random letters, no dictionary.",
+		Length:       offlineLength,
+		AlphabetSize: len(offlineAlphabet()),
+		Entrypoint:   true,
+		Unlocked:     true,
+	}
+
+	words := letters
+	words.Number = offlineWords
+	words.Name = "Words"
+	words.Description = "Words of your word list."
+	words.Unlocked = len(offlineWordlist()) > 0
+	if !words.Unlocked {
+		words.Description = "Needs a word list, pass one with -wordlist."
+	}
+
+	return &game.CatalogResult{
+		Levels: []game.LevelInfo{words, letters},
+	}
+}
+
+// offlineGame starts a game of a practice level.
+func offlineGame(level int) (client.Session, error) {
+	var source game.WordSource
+	invalid := errors.New("Not in character list")
+
+	switch level {
+	case offlineWords:
+		words, err := game.NewWordList(offlineWordlist(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("no words of %d letters in the word list", offlineLength)
+		}
+
+		source = words
+		invalid = errors.New("Not in word list")
+	case offlineLetters:
+		source = offlineGenerator()
+	default:
+		return nil, fmt.Errorf("unknown practice level %d", level)
+	}
+
+	g := &game.Game{
+		Level:           level,
+		Word:            source.Word(rand.Intn),
+		Guesses:         offlineGuesses,
+		Candidates:      offlineAlphabet(),
+		CompleteMessage: "Nice!",
+		Validator: func(g *game.Game, guess []rune) error {
+			if !source.Allowed(guess) {
+				return invalid
+			}
+
+			return nil
+		},
+	}
+
+	return client.NewLocal(g), nil
+}
+
+func fetchCatalog() (*game.CatalogResult, error) {
+	if offline {
+		return offlineCatalog(), nil
+	}
+
+	return player.Catalog()
+}
+
+func fetchLeaderboard() (*game.LeaderboardResult, error) {
+	if offline {
+		return nil, errors.New("The leaderboard is not available offline")
+	}
+
+	return player.Leaderboard()
+}
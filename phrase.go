@@ -0,0 +1,79 @@
+package game
+
+// Phrases are words made of several parts, e.g. "ICE-CREAM" or "PCTF{...}".
+// Their separators are revealed up front, are not typed and are not scored.
+// The indicator of a separator is the separator itself.
+
+// isSeparator reports whether letter separates the parts of the word of g.
+func (g *Game) isSeparator(letter string) bool {
+	for _, s := range g.Separators {
+		if letter == string(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SeparatorCells returns the separator of every letter of the word, 0 for the
+// letters to guess.
+func (g *Game) SeparatorCells() []rune {
+	if len(g.Separators) == 0 {
+		return nil
+	}
+
+	letters := g.Letters(g.Word)
+	cells := make([]rune, len(letters))
+	for i, l := range letters {
+		if g.isSeparator(l) {
+			cells[i] = []rune(l)[0]
+		}
+	}
+
+	return cells
+}
+
+// letterCount returns the number of letters of word to guess.
+func (g *Game) letterCount(word []string) int {
+	count := 0
+	for _, l := range word {
+		if !g.isSeparator(l) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// expandGuess returns guess with the separators of word, either filling them
+// in when guess only has the letters or checking they are in place.
+func (g *Game) expandGuess(word, guess []string) ([]string, bool) {
+	switch len(guess) {
+	case len(word):
+		for i, l := range word {
+			if g.isSeparator(l) != g.isSeparator(guess[i]) || g.isSeparator(l) && l != guess[i] {
+				return nil, false
+			}
+		}
+
+		return guess, true
+	case g.letterCount(word):
+		expanded := make([]string, 0, len(word))
+		for _, l := range word {
+			if g.isSeparator(l) {
+				expanded = append(expanded, l)
+				continue
+			}
+			if g.isSeparator(guess[0]) {
+				return nil, false
+			}
+
+			expanded = append(expanded, guess[0])
+			guess = guess[1:]
+		}
+
+		return expanded, true
+	}
+
+	return nil, false
+}
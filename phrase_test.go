@@ -0,0 +1,69 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandGuess(t *testing.T) {
+	tests := []struct {
+		name       string
+		word       string
+		separators string
+		guess      string
+		expanded   string // empty if the guess is refused
+	}{
+		{"letters only", "ICE-CREAM", "-", "ICECREAM", "ICE-CREAM"},
+		{"separators in place", "ICE-CREAM", "-", "ICE-CREAM", "ICE-CREAM"},
+		{"separator moved", "ICE-CREAM", "-", "ICECR-EAM", ""},
+		{"separator replaced", "ICE-CREAM", "-", "ICE CREAM", ""},
+		{"separator among the letters", "ICE-CREAM", "-", "IC-CREAM", ""},
+		{"too short", "ICE-CREAM", "-", "ICECREA", ""},
+		{"too long", "ICE-CREAM", "-", "ICE-CREAMS", ""},
+		{"several separators", "PCTF{AB_CD}", "{_}", "PCTFABCD", "PCTF{AB_CD}"},
+		{"several separators in place", "PCTF{AB_CD}", "{_}", "PCTF{AB_CD}", "PCTF{AB_CD}"},
+		{"separators swapped", "PCTF{AB_CD}", "{_}", "PCTF_AB{CD}", ""},
+		{"no separators", "CRANE", "", "CRANE", "CRANE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &Game{Word: []rune(test.word), Separators: []rune(test.separators)}
+
+			expanded, ok := g.expandGuess(g.Letters(g.Word), g.Letters([]rune(test.guess)))
+			if test.expanded == "" {
+				if ok {
+					t.Fatalf("expandGuess(%q) = %q, want it refused", test.guess, expanded)
+				}
+				return
+			}
+
+			if !ok || !reflect.DeepEqual(expanded, g.Letters([]rune(test.expanded))) {
+				t.Fatalf("expandGuess(%q) = %q, %v, want %q", test.guess, expanded, ok, test.expanded)
+			}
+		})
+	}
+}
+
+func TestScoreSeparators(t *testing.T) {
+	g := &Game{
+		Word:       []rune("ICE-CREAM"),
+		Guesses:    6,
+		Separators: []rune("-"),
+		Validator:  func(g *Game, guess []rune) error { return nil },
+	}
+
+	if cells := string(g.SeparatorCells()); cells != "\x00\x00\x00-\x00\x00\x00\x00\x00" {
+		t.Errorf("SeparatorCells() = %q", cells)
+	}
+
+	result := g.ProcessGuess([]rune("CREAMICE"))
+	if want := "🟨🟨🟩-🟨🟨🟨🟨🟨"; string(result.Indicators) != want {
+		t.Errorf("indicators = %s, want %s", string(result.Indicators), want)
+	}
+
+	result = g.ProcessGuess([]rune("ICECREAM"))
+	if !result.Complete {
+		t.Errorf("guessing the letters of the phrase did not complete it: %+v", result)
+	}
+}
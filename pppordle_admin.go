@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"pppordle/admin"
+	"pppordle/cert"
+)
+
+func main() {
+	socket := flag.String("socket", admin.DefaultSocket, "admin socket of the server")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [-socket path] <command> [args]
+
+Commands:
+  sessions          list live sessions
+  requests          list level connections waiting for their session
+  kill <session>    close a session
+  reload            reload levels from the level manifest
+  certs             list issued level certificates
+  revoke <match>    revoke certificates by serial, fingerprint or session
+  spectator-cert [dir]
+                    issue an organiser certificate for spectating, saved
+                    as spectator.pem and spectator.key in dir
+`, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	res, err := admin.Call(*socket, admin.Request{
+		Command: flag.Arg(0),
+		Args:    flag.Args()[1:],
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if flag.Arg(0) == "sessions" {
+		fmt.Fprintln(w, "SESSION\tREMOTE\tPLAYER\tLEVEL\tREMAINING\tCONNECTED")
+		for _, s := range res.Sessions {
+			level := fmt.Sprint(s.Level)
+			if s.Spectating {
+				level = "spectating"
+			} else if s.Level == 0 {
+				level = "-"
+			}
+			fmt.Fprintf(w, "%v\t%s\t%s\t%s\t%d\t%s\n", s.ID, s.RemoteAddr, s.Player, level,
+				s.RemainingGuesses, time.Since(s.Connected).Round(time.Second))
+		}
+	}
+	if flag.Arg(0) == "requests" {
+		fmt.Fprintln(w, "SESSION\tLOCAL\tREMOTE")
+		for _, r := range res.Requests {
+			fmt.Fprintf(w, "%v\t%s\t%s\n", r.SessionID, r.LocalAddr, r.RemoteAddr)
+		}
+	}
+	w.Flush()
+
+	if res.Cert != nil {
+		dir := "."
+		if flag.NArg() > 1 {
+			dir = flag.Arg(1)
+		}
+
+		err = saveCert(dir, res.Cert)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	for _, message := range res.Messages {
+		fmt.Println(message)
+	}
+
+	if res.Error != "" {
+		fmt.Fprintln(os.Stderr, res.Error)
+		os.Exit(1)
+	}
+}
+
+func saveCert(dir string, pair *cert.PemCertPair) error {
+	err := os.WriteFile(filepath.Join(dir, "spectator.pem"), pair.Cert, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "spectator.key"), pair.Key, 0600)
+}
@@ -0,0 +1,136 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion is bumped whenever a message changes incompatibly.
+const ProtocolVersion = 2
+
+// SessionProtocol is the ALPN protocol of the session server, clients offer it
+// and LevelProtocol so a server on a single port can route their connections.
+const SessionProtocol = "pppordle-session"
+
+func LevelProtocol(level int) string {
+	return fmt.Sprintf("pppordle-level-%d", level)
+}
+
+type MessageType string
+
+const (
+	MessageRequest     MessageType = "request"
+	MessageInit        MessageType = "init"
+	MessageInfo        MessageType = "info"
+	MessageGuess       MessageType = "guess"
+	MessageCatalog     MessageType = "catalog"
+	MessageEvent       MessageType = "event"
+	MessageLeaderboard MessageType = "leaderboard"
+	MessageShutdown    MessageType = "shutdown"
+	MessageError       MessageType = "error"
+)
+
+// Envelope frames every message on a session connection. Responses carry the
+// ID of the request they answer.
+type Envelope struct {
+	Version int
+	Type    MessageType
+	ID      uint64
+	Payload json.RawMessage
+}
+
+// ErrorResult is sent in place of a result when a request cannot be served.
+type ErrorResult struct {
+	Error string
+}
+
+// ShutdownNotice may be sent at any time, with ID 0, when the server is going
+// away. Games in progress can be played until the deadline.
+type ShutdownNotice struct {
+	Message  string
+	Deadline time.Time
+}
+
+func (*InitResult) MessageType() MessageType        { return MessageInit }
+func (*InfoResult) MessageType() MessageType        { return MessageInfo }
+func (*GuessResult) MessageType() MessageType       { return MessageGuess }
+func (*CatalogResult) MessageType() MessageType     { return MessageCatalog }
+func (*SpectatorEvent) MessageType() MessageType    { return MessageEvent }
+func (*LeaderboardResult) MessageType() MessageType { return MessageLeaderboard }
+func (*ShutdownNotice) MessageType() MessageType    { return MessageShutdown }
+func (*ErrorResult) MessageType() MessageType       { return MessageError }
+
+func WriteMessage(e *json.Encoder, t MessageType, id uint64, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return e.Encode(&Envelope{
+		Version: ProtocolVersion,
+		Type:    t,
+		ID:      id,
+		Payload: data,
+	})
+}
+
+// ReadMessage decodes the next envelope, failing when it was framed with
+// another protocol version.
+func ReadMessage(d *json.Decoder) (*Envelope, error) {
+	var envelope Envelope
+	err := d.Decode(&envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.Version != ProtocolVersion {
+		return &envelope, fmt.Errorf("protocol version mismatch: received %d, expected %d", envelope.Version, ProtocolVersion)
+	}
+
+	return &envelope, nil
+}
+
+// DecodeResult unpacks the payload of a response to request id, checking that
+// it is of the type the caller expects.
+func DecodeResult[R Result](envelope *Envelope, id uint64) (res R, err error) {
+	if envelope.Type == MessageError {
+		var errorResult ErrorResult
+		err = json.Unmarshal(envelope.Payload, &errorResult)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New(errorResult.Error)
+	}
+
+	if envelope.Type != res.MessageType() {
+		return nil, fmt.Errorf("unexpected %q message, expected %q", envelope.Type, res.MessageType())
+	}
+
+	if envelope.ID != id {
+		return nil, fmt.Errorf("response to request %d received, expected %d", envelope.ID, id)
+	}
+
+	err = json.Unmarshal(envelope.Payload, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DecodeShutdown unpacks a shutdown notice.
+func DecodeShutdown(envelope *Envelope) (*ShutdownNotice, error) {
+	if envelope.Type != MessageShutdown {
+		return nil, fmt.Errorf("unexpected %q message, expected %q", envelope.Type, MessageShutdown)
+	}
+
+	var notice ShutdownNotice
+	err := json.Unmarshal(envelope.Payload, &notice)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notice, nil
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often buckets which have refilled are dropped.
+const pruneInterval = time.Minute
+
+// Limiter keeps a token bucket per key, such as a remote IP or a client
+// certificate fingerprint. A nil Limiter allows everything.
+type Limiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New creates a limiter refilling each bucket with perMinute tokens a minute,
+// up to burst tokens. perMinute must be positive.
+func New(perMinute float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		pruned:  time.Now(),
+	}
+}
+
+// refill tops up the bucket of key and returns it.
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	return b
+}
+
+// Allow takes a token from the bucket of every key if they all have one.
+// Otherwise nothing is taken and Allow returns the first key which ran out and
+// how long until it has a token again.
+func (l *Limiter) Allow(keys ...string) (denied string, retry time.Duration) {
+	if l == nil {
+		return "", 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	buckets := make([]*bucket, len(keys))
+	for i, key := range keys {
+		buckets[i] = l.refill(key, now)
+		if buckets[i].tokens < 1 {
+			wait := (1 - buckets[i].tokens) / l.rate
+			return key, time.Duration(wait * float64(time.Second))
+		}
+	}
+
+	for _, b := range buckets {
+		b.tokens -= 1
+	}
+
+	return "", 0
+}
+
+// prune drops the buckets which would be full again, they are recreated full
+// when needed.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < pruneInterval {
+		return
+	}
+	l.pruned = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
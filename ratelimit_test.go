@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	// 60 tokens a minute is a token a second.
+	tests := []struct {
+		name    string
+		tokens  float64 // left in the bucket
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 0, 0, 0},
+		{"partial token", 0, 500 * time.Millisecond, 0.5},
+		{"whole tokens", 1, 2 * time.Second, 3},
+		{"capped at the burst", 2, time.Minute, 5},
+		{"full bucket stays full", 5, time.Second, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := New(60, 5)
+			start := time.Now()
+			l.buckets["key"] = &bucket{tokens: test.tokens, updated: start}
+
+			b := l.refill("key", start.Add(test.elapsed))
+			if b.tokens != test.want {
+				t.Errorf("refilled to %v tokens, want %v", b.tokens, test.want)
+			}
+			if !b.updated.Equal(start.Add(test.elapsed)) {
+				t.Errorf("bucket updated at %v, want %v", b.updated, start.Add(test.elapsed))
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	l := New(60, 2)
+
+	for i := 0; i < 2; i++ {
+		if denied, _ := l.Allow("ip"); denied != "" {
+			t.Fatalf("request %d within the burst denied", i+1)
+		}
+	}
+
+	denied, retry := l.Allow("ip")
+	if denied != "ip" {
+		t.Fatalf("request beyond the burst allowed")
+	}
+	if retry <= 0 || retry > time.Second {
+		t.Errorf("retry after %v, want within a second", retry)
+	}
+
+	// A second later the bucket has a token again.
+	l.buckets["ip"].updated = l.buckets["ip"].updated.Add(-time.Second)
+	if denied, _ := l.Allow("ip"); denied != "" {
+		t.Errorf("request denied after the bucket refilled")
+	}
+}
+
+func TestAllowKeys(t *testing.T) {
+	l := New(60, 1)
+
+	if denied, _ := l.Allow("ip", "cert"); denied != "" {
+		t.Fatalf("first request denied by %q", denied)
+	}
+
+	// The certificate ran out, the new IP keeps its token.
+	if denied, _ := l.Allow("other ip", "cert"); denied != "cert" {
+		t.Fatalf("request denied by %q, want cert", denied)
+	}
+	if denied, _ := l.Allow("other ip"); denied != "" {
+		t.Errorf("token of a key taken by a denied request")
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	if denied, _ := l.Allow("ip"); denied != "" {
+		t.Errorf("nil limiter denied a request")
+	}
+}
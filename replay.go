@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"pppordle/game"
+)
+
+// Replays type the guesses of a transcript out letter by letter, pausing
+// between guesses for as long as the player did, up to replayMaxPause.
+const (
+	replayLetterDelay = 150 * time.Millisecond
+	replayMaxPause    = 2 * time.Second
+)
+
+// replay is a game transcript ready to be played back.
+type replay struct {
+	info    *game.InfoResult
+	guesses []game.TranscriptEntry
+	answer  string
+}
+
+// loadReplay reads a transcript written by the session server. Guesses made
+// before the transcript was started, known from the history of its first
+// info, are played back first.
+func loadReplay(path string) (*replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := game.ReadTranscript(f)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replay{}
+	for _, entry := range entries {
+		switch entry.Event {
+		case game.TranscriptInfo:
+			if r.info != nil || entry.Info == nil {
+				continue
+			}
+
+			info := *entry.Info
+			for _, record := range info.History {
+				r.guesses = append(r.guesses, game.TranscriptEntry{
+					Event:   game.TranscriptGuess,
+					Time:    entry.Time,
+					Request: &game.Request{Type: game.RequestGuess, Data: record.Guess},
+					Guess:   &game.GuessResult{Indicators: record.Indicators},
+				})
+			}
+			info.History = nil
+			r.info = &info
+		case game.TranscriptGuess:
+			if entry.Request != nil && entry.Guess != nil {
+				r.guesses = append(r.guesses, entry)
+			}
+		case game.TranscriptAnswer:
+			r.answer = entry.Answer
+		}
+	}
+
+	if r.info == nil {
+		return nil, errors.New("transcript has no game info")
+	}
+
+	return r, nil
+}
+
+func startReplayUI(r *replay) {
+	grid, state := newBoard(nil, r.info)
+
+	grid.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if state.Complete {
+			switch event.Rune() {
+			case 'c', 'C':
+				shareResult(state, copyToClipboard, "Copied to clipboard")
+			case 's', 'S':
+				shareResult(state, saveShareGrid, "Saved to "+shareFile)
+			}
+		}
+
+		return nil
+	})
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			app.Stop()
+			return nil
+		}
+
+		return event
+	})
+
+	go r.play(state)
+
+	err := app.SetRoot(grid, true).
+		SetFocus(state.CurrentLetter()).
+		Run()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// play types the guesses of the replay into the board and shows their
+// results as they were recorded.
+func (r *replay) play(state *State) {
+	previous := time.Time{}
+	for _, entry := range r.guesses {
+		entry := entry
+
+		pause := replayMaxPause
+		if !previous.IsZero() && entry.Time.Sub(previous) < pause {
+			pause = entry.Time.Sub(previous)
+		}
+		previous = entry.Time
+		time.Sleep(pause)
+
+		letters := game.SplitLetters(entry.Request.Data, r.info.Graphemes)
+		for i, letter := range letters {
+			if len(letters) == r.info.Length && state.isSeparator(i) {
+				continue
+			}
+
+			letter := letter
+			app.QueueUpdateDraw(func() {
+				addLetter(letter, state)
+			})
+			time.Sleep(replayLetterDelay)
+		}
+
+		app.QueueUpdateDraw(func() {
+			showResult(state, entry.Request.Data, entry.Guess)
+		})
+		if len(entry.Guess.Indicators) == 0 {
+			time.Sleep(replayMaxPause)
+			app.QueueUpdateDraw(func() {
+				clearGuess(state)
+			})
+		}
+	}
+
+	time.Sleep(replayMaxPause)
+	app.QueueUpdateDraw(func() {
+		if !state.Complete {
+			state.SetMessage("End of transcript, the game was not finished", false)
+		} else if !state.Solved && r.answer != "" {
+			state.SetMessage("The answer was "+r.answer+sharePrompt, false)
+		}
+	})
+}
+
+// clearGuess empties the current guess after it was rejected.
+func clearGuess(state *State) {
+	for i, letter := range state.CurrentLetters() {
+		if !state.isSeparator(i) {
+			letter.SetLabel("")
+		}
+	}
+	state.LetterIndex = state.seekLetter(0, 1)
+	app.SetFocus(state.CurrentLetter())
+}
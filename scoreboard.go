@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"pppordle/game"
+)
+
+const leaderboardSize = 20
+
+const maxHandleLength = 24
+
+var Scores = &Scoreboard{}
+
+// Completion is a level solved by a player. Player is the ID the player's
+// level certificates carry, Handle the name they chose, if any. Handles are
+// not authenticated, so results are only ever grouped by ID.
+type Completion struct {
+	Player    string
+	Handle    string `json:",omitempty"`
+	Level     int
+	Guesses   int
+	SolveTime time.Duration
+	Completed time.Time
+}
+
+// Scoreboard records level completions, persisting them to a file when it has
+// a path.
+type Scoreboard struct {
+	mutex       sync.Mutex
+	path        string
+	completions []Completion
+}
+
+func LoadScoreboard(path string) (*Scoreboard, error) {
+	scoreboard := &Scoreboard{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return scoreboard, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &scoreboard.completions)
+	if err != nil {
+		return nil, err
+	}
+
+	return scoreboard, nil
+}
+
+func (sb *Scoreboard) Record(completion Completion) error {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	sb.completions = append(sb.completions, completion)
+
+	if sb.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(sb.completions)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(sb.path), "scoreboard-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), sb.path)
+}
+
+// Leaderboard ranks players by levels solved, then by the guesses and time
+// their best solve of each level took.
+func (sb *Scoreboard) Leaderboard(limit int) []game.LeaderboardEntry {
+	sb.mutex.Lock()
+	best := make(map[string]map[int]Completion)
+	handles := make(map[string]string)
+	for _, c := range sb.completions {
+		if c.Handle != "" {
+			handles[c.Player] = c.Handle
+		}
+
+		levels, ok := best[c.Player]
+		if !ok {
+			levels = make(map[int]Completion)
+			best[c.Player] = levels
+		}
+
+		previous, ok := levels[c.Level]
+		if !ok || c.Guesses < previous.Guesses ||
+			(c.Guesses == previous.Guesses && c.SolveTime < previous.SolveTime) {
+			levels[c.Level] = c
+		}
+	}
+	sb.mutex.Unlock()
+
+	var entries []game.LeaderboardEntry
+	for player, levels := range best {
+		entry := game.LeaderboardEntry{
+			Player: playerName(player, handles[player]),
+			Levels: len(levels),
+		}
+		for _, c := range levels {
+			entry.Guesses += c.Guesses
+			entry.SolveTime += c.SolveTime
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Levels != entries[j].Levels {
+			return entries[i].Levels > entries[j].Levels
+		}
+		if entries[i].Guesses != entries[j].Guesses {
+			return entries[i].Guesses < entries[j].Guesses
+		}
+		if entries[i].SolveTime != entries[j].SolveTime {
+			return entries[i].SolveTime < entries[j].SolveTime
+		}
+		return entries[i].Player < entries[j].Player
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	return entries
+}
+
+// playerName shows a player as their handle, or "player" without one, tagged
+// with the start of their ID to tell apart players using the same handle.
+func playerName(player, handle string) string {
+	if handle == "" {
+		handle = "player"
+	}
+	if len(player) > 8 {
+		player = player[:8]
+	}
+
+	return handle + "#" + player
+}
@@ -1,170 +1,402 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
+	"net"
 	"os"
-	"strings"
+	"os/signal"
 	"sync"
-
-	"github.com/google/uuid"
+	"syscall"
+	"time"
 
 	"pppordle/cert"
 	"pppordle/check"
+	"pppordle/game"
+	"pppordle/logging"
+	"pppordle/ratelimit"
 	"pppordle/server/level"
 )
 
-const (
-	sessionPort = 1337
-)
-
 var (
-	domain = "pppordle.chal.pwni.ng"
-	dev    = os.Getenv("PPPORDLE_ENV")
-	pemCA  *cert.PemCertPair
+	pemCA *cert.PemCertPair
 )
 
 func main() {
-	f, err := os.OpenFile("pppordle.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	cfg, args, err := LoadServerConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	f, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	check.Fatal("could not open log file", err)
 	defer f.Close()
-	log.SetOutput(f)
-
-	certName := "ca"
-	if dev == "dev" {
-		log.Println("starting server in development mode")
-		domain = "localhost"
-		certName = "dev_ca"
-	}
-	caCert, err := os.ReadFile(fmt.Sprintf("certs/%s.pem", certName))
-	check.Fatal("unable to read ca cert", err)
-	caKey, err := os.ReadFile(fmt.Sprintf("certs/%s.key", certName))
-	check.Fatal("unable to read ca key", err)
+
+	logger := logging.New(f, cfg.LogSeverity, cfg.LogSecrets)
+	fatal := func(message string, err error) {
+		if err != nil {
+			logger.Fatal("server.start", message, "error", err)
+		}
+	}
+
+	if cfg.Dev {
+		logger.Info("server.start", "starting server in development mode")
+	}
+	caCert, err := os.ReadFile(cfg.CACert)
+	fatal("unable to read ca cert", err)
+	caKey, err := os.ReadFile(cfg.CAKey)
+	fatal("unable to read ca key", err)
 	pemCA = &cert.PemCertPair{
 		Cert: caCert,
 		Key:  caKey,
 	}
 
+	Certs, err = LoadCertRegistry(cfg.CertRegistry)
+	fatal("unable to load certificate registry", err)
+
+	if len(args) > 0 {
+		err = runCertCommand(args, cfg.CRL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err = Certs.WriteCRL(pemCA, cfg.CRL)
+	fatal("unable to write revocation list", err)
+	go reloadCertsOnHangup(cfg.CRL, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Levels are reached by SNI as level<n>.<domain> on a single port.
+	dnsNames := []string{cfg.Domain}
+	if cfg.SinglePort {
+		dnsNames = append(dnsNames, "*."+cfg.Domain)
+	}
 	pemServer, err := cert.MakeCerts(cert.CertConfig{
 		Parent:     pemCA,
 		IsServer:   true,
 		IsClient:   false,
 		Serial:     big.NewInt(1),
-		CommonName: domain,
-		DNSNames:   []string{domain, "*.session"},
-		SecsValid:  60 * 60 * 24 * 365,
+		CommonName: cfg.Domain,
+		DNSNames:   dnsNames,
+		SecsValid:  uint(cfg.ServerCertValidity.Seconds()),
 	})
-	check.Fatal("unable to generate server certificate pair", err)
+	fatal("unable to generate server certificate pair", err)
 
 	caCertPool := x509.NewCertPool()
 	ok := caCertPool.AppendCertsFromPEM(pemCA.Cert)
 	if !ok {
-		log.Fatalf("failed to add ca cert to pool")
+		logger.Fatal("server.start", "failed to add ca cert to pool")
 	}
 
-	var levels []LevelServer
+	manifest, err := level.LoadManifest(cfg.Levels)
+	fatal("unable to load level manifest", err)
 
-	levels = append(levels, LevelServer{
-		Level:      level.Level1(),
-		Entrypoint: true,
-	})
+	if cfg.SessionStore != "" {
+		Store, err = NewFileSessionStore(cfg.SessionStore)
+		fatal("unable to open session store", err)
+	}
 
-	levels = append(levels, LevelServer{
-		Level: level.Level2(),
-	})
+	if cfg.TranscriptDir != "" {
+		err = os.MkdirAll(cfg.TranscriptDir, 0700)
+		fatal("unable to create transcript directory", err)
+	}
 
-	levels = append(levels, LevelServer{
-		Level: level.Level3(),
-	})
+	Scores, err = LoadScoreboard(cfg.Scoreboard)
+	fatal("unable to load scoreboard", err)
 
-	levels = append(levels, LevelServer{
-		Level: level.Level4(),
-	})
+	Bindings, err = NewBindingSigner(cfg.BindingValidity.Duration)
+	fatal("unable to create session token key", err)
+
+	// The limit is shared so that spreading connections over the levels
+	// doesn't get around it.
+	levelLimiter := newLimiter(cfg.LevelRate, cfg.LevelBurst)
+
+	var levels []*LevelServer
+	for _, spec := range manifest.Enabled() {
+		l, err := newLevelServer(spec, cfg, levelLimiter, logger)
+		fatal("unable to build level", err)
+		levels = append(levels, l)
+	}
 
 	serverCert, err := tls.X509KeyPair(pemServer.Cert, pemServer.Key)
-	check.Fatal("unable to load server certificate pair", err)
+	fatal("unable to load server certificate pair", err)
+
+	var mux *Mux
+	if cfg.SinglePort {
+		mux = NewMux(cfg.SessionPort, logger)
+	}
 
+	// A listener failing shuts the whole server down rather than leaving it
+	// half up.
 	var wg sync.WaitGroup
-	wg.Add(len(levels))
-	for i, l := range levels {
-		l.Port = sessionPort + i + 1
+	serve := func(name string, listen func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := listen()
+			if err != nil {
+				logger.Error("server.listen", name+" listener failed", "error", err)
+				stop()
+			}
+		}()
+	}
+
+	for _, l := range levels {
 		l.Config = &tls.Config{
-			Certificates:       []tls.Certificate{serverCert},
-			MinVersion:         tls.VersionTLS13,
-			GetConfigForClient: getSessionFromHello,
+			Certificates: []tls.Certificate{serverCert},
+			MinVersion:   tls.VersionTLS13,
 		}
 
 		if !l.Entrypoint {
 			l.Config.ClientAuth = tls.RequireAndVerifyClientCert
 			l.Config.ClientCAs = caCertPool
-			l.Config.VerifyPeerCertificate = getLevelValidator(caCertPool, l.Level.Number)
+			l.Config.VerifyPeerCertificate = getLevelValidator(caCertPool, l.Number)
 		}
 
-		fmt.Printf("Starting level %d listener\n", l.Level.Number)
-		go func(levelServer LevelServer) {
-			levelServer.Host()
-			wg.Done()
-		}(l)
+		levelServer := l
+		if mux != nil {
+			listener := mux.Listener(game.LevelProtocol(l.Number), l.Config)
+			serve(fmt.Sprintf("level %d", l.Number), func() error {
+				return levelServer.Serve(ctx, listener)
+			})
+			continue
+		}
+
+		fmt.Printf("Starting level %d listener\n", l.Number)
+		serve(fmt.Sprintf("level %d", l.Number), func() error {
+			return levelServer.Host(ctx)
+		})
+	}
+
+	serve("admin", func() error {
+		return handleAdmin(ctx, cfg, logger, levels)
+	})
+
+	// Metrics are optional, the game carries on without them.
+	if cfg.MetricsAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := serveMetrics(ctx, cfg.MetricsAddr)
+			if err != nil {
+				logger.Error("server.listen", "metrics listener failed", "error", err)
+			}
+		}()
 	}
 
-	fmt.Println("Starting session listener")
-	handleSessions(sessionPort, &tls.Config{
+	// Players connect without a certificate, organisers present one to
+	// spectate.
+	sessionConfig := &tls.Config{
 		Certificates: []tls.Certificate{serverCert},
 		MinVersion:   tls.VersionTLS13,
-	}, len(levels))
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    caCertPool,
+	}
+	var sessionListener net.Listener
+	if mux != nil {
+		sessionListener = mux.Listener(game.SessionProtocol, sessionConfig)
+
+		fmt.Printf("Starting single port listener on %d\n", cfg.SessionPort)
+		serve("mux", func() error {
+			return mux.Serve(ctx)
+		})
+	} else {
+		fmt.Println("Starting session listener")
+		sessionListener, err = tls.Listen("tcp", fmt.Sprintf(":%d", cfg.SessionPort), sessionConfig)
+		fatal("session listener failed", err)
+	}
+	serve("session", func() error {
+		return handleSessions(ctx, cfg, logger, sessionListener, levels)
+	})
+
+	<-ctx.Done()
+	fmt.Println("Shutting down")
+	logger.Info("server.shutdown", "shutting down, draining sessions")
 
 	wg.Wait()
+	logger.Info("server.shutdown", "shutdown complete")
+	check.Print("unable to flush log file", f.Sync())
 }
 
-func getLevelValidator(caCertPool *x509.CertPool, levelNumber int) func([][]byte, [][]*x509.Certificate) error {
-	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
-			return errors.New("No verified chains")
+// runCertCommand implements the certificate administration commands:
+//
+//	certs              list issued certificates
+//	revoke <match>     revoke certificates by serial, fingerprint or session ID
+//
+// A running server picks up revocations on SIGHUP.
+func runCertCommand(args []string, crlPath string) error {
+	switch args[0] {
+	case "certs":
+		for _, c := range Certs.List() {
+			status := "valid"
+			if c.Revoked {
+				status = "revoked " + c.RevokedAt.Format(time.RFC3339)
+			} else if time.Now().After(c.Expires) {
+				status = "expired"
+			}
+			fmt.Printf("%s level=%d session=%v player=%q fingerprint=%s %s\n",
+				c.Serial, c.Level, c.SessionID, c.Player, c.Fingerprint, status)
+		}
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("usage: revoke <serial|fingerprint|session>")
 		}
 
-		opts := x509.VerifyOptions{
-			DNSName:   fmt.Sprint(levelNumber),
-			Roots:     caCertPool,
-			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		revoked, err := Certs.Revoke(args[1])
+		if err != nil {
+			return err
 		}
-		_, err := verifiedChains[0][0].Verify(opts)
-		return err
+		for _, c := range revoked {
+			fmt.Printf("revoked %s (level %d, session %v)\n", c.Serial, c.Level, c.SessionID)
+		}
+
+		return Certs.WriteCRL(pemCA, crlPath)
 	}
+
+	return fmt.Errorf("unknown command %q", args[0])
 }
 
-func getSessionFromHello(hello *tls.ClientHelloInfo) (*tls.Config, error) {
-	sessionID, err := parseSessionID(hello.ServerName)
-	if err != nil {
-		return nil, nil
+func reloadCertsOnHangup(crlPath string, logger *logging.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		logger.Info("certs.reload", "reloading certificate registry")
+		err := Certs.Reload()
+		if err != nil {
+			logger.Error("certs.reload", "unable to reload certificate registry", "error", err)
+			continue
+		}
+
+		err = Certs.WriteCRL(pemCA, crlPath)
+		if err != nil {
+			logger.Error("certs.reload", "unable to write revocation list", "error", err)
+		}
 	}
+}
 
-	sessionConn := Conn{
-		LocalAddr:  hello.Conn.LocalAddr(),
-		RemoteAddr: hello.Conn.RemoteAddr(),
+func newLevelServer(spec level.Spec, cfg *ServerConfig, levelLimiter *ratelimit.Limiter, logger *logging.Logger) (*LevelServer, error) {
+	l, err := spec.Build(cfg.Daily())
+	if err != nil {
+		return nil, err
 	}
 
-	RequestMutex.Lock()
-	Requests[sessionConn] = sessionID
-	RequestMutex.Unlock()
+	ls := &LevelServer{
+		Port:       cfg.LevelPort(spec.PortOffset),
+		Number:     spec.Number,
+		Entrypoint: spec.Entrypoint,
+		Limiter:    levelLimiter,
+		Log:        logger.With("level", spec.Number),
+	}
+	ls.SetLevel(l, levelInfo(spec, l, ls.Port))
 
-	return nil, nil
+	return ls, nil
 }
 
-func parseSessionID(domain string) (*uuid.UUID, error) {
-	splitString := strings.Split(domain, ".")
+func levelInfo(spec level.Spec, l *level.Level, port int) game.LevelInfo {
+	sample := l.GenerateGame()
 
-	if len(splitString) != 2 {
-		return nil, fmt.Errorf("session parsing failed: %w", errors.New("improperly formatted server name"))
+	return game.LevelInfo{
+		Number:       spec.Number,
+		Name:         spec.Name,
+		Description:  spec.Description,
+		Port:         port,
+		Length:       sample.Length(),
+		AlphabetSize: len(sample.Candidates),
+		Entrypoint:   spec.Entrypoint,
+		HardMode:     spec.HardMode,
+		Daily:        spec.Daily,
 	}
+}
 
-	sessionID, err := uuid.Parse(splitString[0])
+// reloadLevels rebuilds the hosted levels from the manifest. Listeners are
+// not restarted, so levels which were added or removed or changed ports or
+// entrypoints are reported and left untouched.
+func reloadLevels(levels []*LevelServer, cfg *ServerConfig) ([]string, error) {
+	manifest, err := level.LoadManifest(cfg.Levels)
 	if err != nil {
-		return nil, fmt.Errorf("session parsing failed: %w", err)
+		return nil, err
+	}
+
+	var notes []string
+	reloaded := make(map[int]struct{})
+	for _, spec := range manifest.Enabled() {
+		var ls *LevelServer
+		for _, l := range levels {
+			if l.Number == spec.Number {
+				ls = l
+			}
+		}
+
+		if ls == nil {
+			notes = append(notes, fmt.Sprintf("level %d: added, restart required", spec.Number))
+			continue
+		}
+		if ls.Port != cfg.LevelPort(spec.PortOffset) || ls.Entrypoint != spec.Entrypoint {
+			notes = append(notes, fmt.Sprintf("level %d: port or entrypoint changed, restart required", spec.Number))
+			continue
+		}
+
+		l, err := spec.Build(cfg.Daily())
+		if err != nil {
+			return notes, err
+		}
+		ls.SetLevel(l, levelInfo(spec, l, ls.Port))
+		reloaded[spec.Number] = struct{}{}
+		notes = append(notes, fmt.Sprintf("level %d: reloaded", spec.Number))
+	}
+
+	for _, l := range levels {
+		if _, ok := reloaded[l.Number]; !ok {
+			notes = append(notes, fmt.Sprintf("level %d: not reloaded, restart required", l.Number))
+		}
 	}
 
-	return &sessionID, nil
+	return notes, nil
+}
+
+// nextLevel returns the number of the level following levelNumber in manifest
+// order, if there is one.
+func nextLevel(levels []*LevelServer, levelNumber int) (int, bool) {
+	for i, l := range levels {
+		if l.Number == levelNumber && i+1 < len(levels) {
+			return levels[i+1].Number, true
+		}
+	}
+
+	return 0, false
+}
+
+func getLevelValidator(caCertPool *x509.CertPool, levelNumber int) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return errors.New("No verified chains")
+		}
+
+		opts := x509.VerifyOptions{
+			DNSName:   fmt.Sprint(levelNumber),
+			Roots:     caCertPool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		_, err := verifiedChains[0][0].Verify(opts)
+		if err != nil {
+			return err
+		}
+
+		if Certs.IsRevoked(verifiedChains[0][0].SerialNumber) {
+			return errors.New("Certificate revoked")
+		}
+
+		return nil
+	}
 }
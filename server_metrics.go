@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pppordle/metrics"
+)
+
+var (
+	Metrics = metrics.NewRegistry()
+
+	sessionsAccepted = Metrics.Counter("pppordle_sessions_accepted_total",
+		"Connections accepted by the session server.")
+	sessionsActive = Metrics.Gauge("pppordle_sessions_active",
+		"Sessions currently connected.")
+	authTimeouts = Metrics.Counter("pppordle_auth_timeouts_total",
+		"Sessions closed because no level server authenticated them in time.")
+	levelConnections = Metrics.Counter("pppordle_level_connections_total",
+		"Connections accepted by a level server.", "level")
+	sessionLookupFailures = Metrics.Counter("pppordle_session_lookup_failures_total",
+		"Level connections which could not be linked to a session.", "level", "reason")
+	rateLimited = Metrics.Counter("pppordle_rate_limited_total",
+		"Connections refused by the rate limiter.", "server", "key")
+	gamesStarted = Metrics.Counter("pppordle_games_started_total",
+		"Games started, including resumed games.", "level")
+	guessesProcessed = Metrics.Counter("pppordle_guesses_total",
+		"Guesses received, by whether they were scored or rejected.", "level", "result")
+	levelCompletions = Metrics.Counter("pppordle_level_completions_total",
+		"Games won.", "level")
+	levelFailures = Metrics.Counter("pppordle_level_failures_total",
+		"Games lost by running out of guesses.", "level")
+	guessesToComplete = Metrics.Histogram("pppordle_guesses_to_complete",
+		"Guesses used by won games.", []float64{1, 2, 3, 4, 5, 6, 8, 10}, "level")
+	guessLatency = Metrics.Histogram("pppordle_process_guess_seconds",
+		"Time taken to score a guess.", metrics.DefaultBuckets, "level")
+)
+
+// serveMetrics exposes the server metrics on /metrics of addr until ctx is
+// cancelled.
+func serveMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Metrics)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func levelLabel(level int) string {
+	return strconv.Itoa(level)
+}
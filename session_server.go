@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"net"
+	"strings"
+	"unicode"
+
+	"pppordle/admin"
 	"pppordle/cert"
-	"pppordle/check"
 	"pppordle/game"
+	"pppordle/logging"
 	"sync"
 	"time"
 
@@ -19,7 +26,53 @@ import (
 
 type Session struct {
 	Conn     Conn
-	GameChan chan *game.Game
+	GameChan chan *Authentication
+	// Playing is closed once the session has a game, level authentications
+	// are then refused.
+	Playing     chan struct{}
+	Done        chan struct{}
+	ResumeToken string
+	Status      *SessionStatus
+	Kill        func()
+}
+
+// SessionStatus is the progress of a live session, as shown to admins.
+type SessionStatus struct {
+	mutex      sync.Mutex
+	Connected  time.Time
+	Player     string
+	Level      int
+	Remaining  int
+	Spectating bool
+}
+
+func (status *SessionStatus) Update(update func(status *SessionStatus)) {
+	status.mutex.Lock()
+	update(status)
+	status.mutex.Unlock()
+}
+
+func (status *SessionStatus) Admin(id uuid.UUID, remoteAddr net.Addr) admin.Session {
+	status.mutex.Lock()
+	defer status.mutex.Unlock()
+
+	return admin.Session{
+		ID:               id,
+		RemoteAddr:       remoteAddr.String(),
+		Player:           status.Player,
+		Level:            status.Level,
+		RemainingGuesses: status.Remaining,
+		Connected:        status.Connected,
+		Spectating:       status.Spectating,
+	}
+}
+
+// Authentication is handed from a level server to the session it
+// authenticated. Player is the player named by the client certificate, or
+// empty on entrypoint levels.
+type Authentication struct {
+	Game   *game.Game
+	Player string
 }
 
 type Conn struct {
@@ -33,18 +86,44 @@ var (
 )
 
 var (
-	timeout     = 1 * time.Minute
-	authTimeout = 3 * time.Second
+	Store SessionStore = NewMemorySessionStore()
 )
 
-func handleSessions(port int, tlsConfig *tls.Config, levelCount int) {
-	listener, err := tls.Listen("tcp", fmt.Sprintf(":%d", port), tlsConfig)
-	check.Fatal("session listener failed", err)
+// handleSessions accepts sessions from listener until ctx is cancelled, then
+// gives the games in progress until the shutdown grace period is over to
+// finish.
+func handleSessions(ctx context.Context, cfg *ServerConfig, logger *logging.Logger, listener net.Listener, levels []*LevelServer) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	limiter := newLimiter(cfg.SessionRate, cfg.SessionBurst)
+	go sweepSessions(ctx, cfg.ResumeWindow.Duration, logger)
 
+	var sessions sync.WaitGroup
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Println("Error accepting connection:", err)
+			if ctx.Err() != nil {
+				break
+			}
+			logger.Warn("session.accept", "error accepting connection", "error", err)
+			continue
+		}
+
+		key, retry := limiter.Allow(rateLimitKeys(conn.RemoteAddr(), "")...)
+		if key != "" {
+			rateLimited.Inc("session", rateLimitKind(key))
+			logger.Warn("session.rate_limit", "rate limited", "remote", conn.RemoteAddr(), "key", key, "retry", retry)
+			go rejectSession(conn, rateLimitError(retry))
+			continue
+		}
+
+		resumeToken, err := generateResumeToken()
+		if err != nil {
+			logger.Error("session.accept", "error generating resume token", "error", err)
+			conn.Close()
 			continue
 		}
 
@@ -54,116 +133,718 @@ func handleSessions(port int, tlsConfig *tls.Config, levelCount int) {
 				LocalAddr:  conn.LocalAddr(),
 				RemoteAddr: conn.RemoteAddr(),
 			},
-			GameChan: make(chan *game.Game),
+			GameChan:    make(chan *Authentication),
+			Playing:     make(chan struct{}),
+			Done:        make(chan struct{}),
+			ResumeToken: resumeToken,
+			Status:      &SessionStatus{Connected: time.Now()},
+			Kill:        func() { conn.Close() },
 		}
 		SessionMutex.Lock()
 		Sessions[sessionId] = session
 		SessionMutex.Unlock()
-		log.Printf("new session from %v: %v", conn.RemoteAddr(), sessionId)
+		sessionLog := logger.With("session", sessionId, "remote", conn.RemoteAddr())
+		sessionLog.Info("session.new", "new session")
+		sessionsAccepted.Inc()
+		sessionsActive.Inc()
 
+		sessions.Add(1)
 		go func() {
-			handleSession(conn, session, sessionId, levelCount)
+			defer sessions.Done()
+			handleSession(ctx, cfg, sessionLog, conn, session, sessionId, levels)
 			SessionMutex.Lock()
 			delete(Sessions, sessionId)
 			SessionMutex.Unlock()
+			close(session.Done)
+			sessionsActive.Dec()
 		}()
 	}
-}
 
-func handleSession(conn net.Conn, session Session, id uuid.UUID, levelCount int) {
-	var req game.Request
-	var g *game.Game
+	drainSessions(&sessions, cfg.ShutdownGrace.Duration, logger)
+	return nil
+}
 
+// rejectSession tells a client its session was refused and hangs up.
+func rejectSession(conn net.Conn, err error) {
 	defer conn.Close()
 
-	decoder := json.NewDecoder(conn)
-	encoder := json.NewEncoder(conn)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	game.WriteMessage(json.NewEncoder(conn), game.MessageError, 0, &game.ErrorResult{Error: err.Error()})
+}
 
-	err := conn.SetDeadline(time.Now().Add(timeout))
-	if err != nil {
-		log.Println("Failed to set deadline:", err)
+// drainSessions waits for the sessions to end, killing those still running
+// once the shutdown grace period is over.
+func drainSessions(sessions *sync.WaitGroup, grace time.Duration, logger *logging.Logger) {
+	drained := make(chan struct{})
+	go func() {
+		sessions.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
 		return
+	case <-time.After(grace):
 	}
 
-	initMessage := &game.InitResult{
-		SessionID:  id,
-		LevelCount: levelCount,
+	SessionMutex.Lock()
+	logger.Warn("server.shutdown", "killing sessions after the shutdown grace period", "sessions", len(Sessions))
+	for _, session := range Sessions {
+		session.Kill()
 	}
-	err = encoder.Encode(initMessage)
+	SessionMutex.Unlock()
+
+	<-drained
+}
+
+// sessionHandler serves the requests of a single session connection.
+type sessionHandler struct {
+	ctx     context.Context
+	cfg     *ServerConfig
+	log     *logging.Logger
+	conn    net.Conn
+	encoder *json.Encoder
+	session Session
+	id      uuid.UUID
+	levels  []*LevelServer
+
+	// gameChan receives the game of a level authentication, it is nil once
+	// the session has a game.
+	gameChan    chan *Authentication
+	game        *game.Game
+	record      *SessionRecord
+	guesses     int
+	pendingInfo []uint64
+	requests    chan sessionRequest
+	handle      string
+
+	// initResult is the init result of the session without its tokens, as
+	// written to the transcript of its game.
+	initResult *game.InitResult
+	transcript *Transcript
+}
+
+// sessionRequest is a request along with the ID of its envelope, or the reason
+// the envelope could not be read as a request.
+type sessionRequest struct {
+	ID uint64
+	game.Request
+	Err error
+}
+
+func handleSession(ctx context.Context, cfg *ServerConfig, logger *logging.Logger, conn net.Conn, session Session, id uuid.UUID, levels []*LevelServer) {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		conn.Close()
+	}()
+
+	err := conn.SetDeadline(time.Now().Add(cfg.Timeout.Duration))
 	if err != nil {
-		log.Println("Error sending result of game information request:", err)
+		logger.Error("session.deadline", "failed to set deadline", "error", err)
 		return
 	}
 
-	authTimer := time.NewTimer(authTimeout)
-	select {
-	case g = <-session.GameChan:
-		log.Printf("session %v: level %d authentication successful", id, g.Level)
-		log.Println(string(g.Word))
-	case <-authTimer.C:
-		log.Printf("session %v: authentication timeout", id)
-		return
+	h := &sessionHandler{
+		ctx:      ctx,
+		cfg:      cfg,
+		log:      logger,
+		conn:     conn,
+		encoder:  json.NewEncoder(conn),
+		session:  session,
+		id:       id,
+		levels:   levels,
+		gameChan: session.GameChan,
+		record: &SessionRecord{
+			ID:          id,
+			Owner:       id,
+			ResumeToken: session.ResumeToken,
+		},
+	}
+
+	defer func() {
+		h.transcript.Close()
+	}()
+
+	requests := readRequests(json.NewDecoder(conn), done)
+	h.requests = requests
+	shutdown := ctx.Done()
+
+	authTimer := time.NewTimer(cfg.AuthTimeout.Duration)
+	defer authTimer.Stop()
+
+	for {
+		select {
+		case auth := <-h.gameChan:
+			h.playing()
+			authTimer.Stop()
+			g := auth.Game
+			h.log.Info("session.auth", "level authentication successful",
+				"level", g.Level, "word", logging.Secret(string(g.Word)))
+
+			h.record.Game = g
+			h.record.Remaining = g.Guesses
+			h.record.Player = auth.Player
+			if h.record.Player == "" {
+				h.record.Player = uuid.New().String()
+			}
+			h.record.Started = time.Now()
+			if !h.startGame() {
+				return
+			}
+		case <-authTimer.C:
+			if h.game == nil {
+				h.log.Info("session.auth_timeout", "authentication timeout")
+				authTimeouts.Inc()
+				h.sendError(0, "Authentication timeout")
+				return
+			}
+		case <-shutdown:
+			shutdown = nil
+			if !h.shutdown() {
+				return
+			}
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+
+			if req.Err != nil {
+				h.log.Warn("session.request", "invalid request", "error", req.Err)
+				h.sendError(req.ID, req.Err.Error())
+				return
+			}
+
+			if !h.handleRequest(req) {
+				return
+			}
+		}
 	}
+}
 
-	guesses := g.Guesses
+// handleRequest dispatches a request, returning false once the session is
+// over.
+func (h *sessionHandler) handleRequest(req sessionRequest) bool {
+	switch req.Type {
+	case game.RequestInit:
+		h.handle = sanitizeHandle(req.Data)
+		h.initResult = &game.InitResult{
+			SessionID:  h.id,
+			LevelCount: len(h.levels),
+		}
+		return h.send(req.ID, &game.InitResult{
+			SessionID:    h.id,
+			ResumeToken:  h.session.ResumeToken,
+			BindingToken: Bindings.Issue(h.id),
+			LevelCount:   len(h.levels),
+		})
+	case game.RequestCatalog:
+		return h.send(req.ID, levelCatalog(h.levels))
+	case game.RequestLeaderboard:
+		return h.send(req.ID, &game.LeaderboardResult{
+			Entries: Scores.Leaderboard(leaderboardSize),
+		})
+	case game.RequestInfo:
+		if h.game == nil {
+			h.pendingInfo = append(h.pendingInfo, req.ID)
+			return true
+		}
+		return h.send(req.ID, h.info())
+	case game.RequestResume:
+		if h.game != nil {
+			return h.sendError(req.ID, "Session already has a game")
+		}
+
+		record, previous, err := resumeSession(req.Data, h.levels, h.cfg.ResumeWindow.Duration, h.id)
+		if err != nil {
+			h.log.Info("session.resume", "resume failed", "error", err)
+			h.sendError(req.ID, err.Error())
+			return false
+		}
+		h.log.Info("session.resume", "resumed session", "resumed", record.ID, "level", record.Game.Level)
+
+		// The session the game was taken from may still be connected, it
+		// can't save its guesses any more and is hung up on.
+		SessionMutex.Lock()
+		session, ok := Sessions[previous]
+		SessionMutex.Unlock()
+		if ok && previous != h.id {
+			session.Kill()
+		}
 
-	infoMessage := &game.InfoResult{
-		Length:     len(g.Word),
-		Level:      g.Level,
-		Guesses:    guesses,
-		Candidates: g.Candidates,
+		h.record = record
+		h.playing()
+		h.pendingInfo = append(h.pendingInfo, req.ID)
+		return h.startGame()
+	case game.RequestGuess:
+		if h.game == nil {
+			return h.sendError(req.ID, "No game in progress")
+		}
+		return h.guess(req)
+	case game.RequestSpectate:
+		if h.game != nil {
+			return h.sendError(req.ID, "Session already has a game")
+		}
+		if !h.organiser() {
+			h.log.Info("session.spectate", "spectating refused without an organiser certificate")
+			h.sendError(req.ID, "Spectating needs an organiser certificate")
+			return false
+		}
+		h.spectate(req)
+		return false
+	case game.RequestKeepalive:
+		return true
+	}
+
+	return h.sendError(req.ID, fmt.Sprintf("Unknown request type %d", req.Type))
+}
+
+// shutdown tells the client the server is going away, returning false unless
+// a game is in progress. Games may be played until the shutdown grace period
+// is over and can be resumed once the server is back.
+func (h *sessionHandler) shutdown() bool {
+	deadline := time.Now().Add(h.cfg.ShutdownGrace.Duration)
+	h.log.Info("session.shutdown", "notifying client of shutdown", "deadline", deadline)
+
+	if !h.send(0, &game.ShutdownNotice{
+		Message:  "Server shutting down",
+		Deadline: deadline,
+	}) {
+		return false
+	}
+
+	if h.game == nil {
+		return false
 	}
-	err = encoder.Encode(infoMessage)
+
+	err := h.conn.SetDeadline(deadline)
 	if err != nil {
-		log.Println("Error sending result of game information request:", err)
-		return
+		h.log.Error("session.deadline", "failed to set deadline", "error", err)
+		return false
 	}
 
-	for {
-		err := decoder.Decode(&req)
+	return true
+}
+
+// startGame saves the game of the session record and answers the info
+// requests waiting on it.
+func (h *sessionHandler) startGame() bool {
+	h.game = h.record.Game
+
+	if h.record.Result != nil {
+		// The game is over and the player only needs its result again.
+		for _, id := range h.pendingInfo {
+			h.send(id, h.info())
+		}
+		return false
+	}
+	h.log = h.log.With("level", h.game.Level)
+	gamesStarted.Inc(levelLabel(h.game.Level))
+	h.guesses = h.record.Remaining
+
+	h.record.Updated = time.Now()
+	err := Store.Save(h.record)
+	if err != nil {
+		h.log.Error("session.store", "failed to save session", "error", err)
+		return false
+	}
+
+	if h.cfg.TranscriptDir != "" {
+		h.transcript, err = OpenTranscript(h.cfg.TranscriptDir, h.record.ID)
 		if err != nil {
-			return
+			h.log.Error("session.transcript", "failed to open transcript", "error", err)
 		}
+		if h.initResult != nil {
+			h.transcribe(game.TranscriptEntry{Event: game.TranscriptInit, Init: h.initResult})
+		}
+		h.transcribe(game.TranscriptEntry{Event: game.TranscriptInfo, Info: h.info()})
+	}
 
-		if req.Type != game.RequestGuess {
-			return
+	for _, id := range h.pendingInfo {
+		if !h.send(id, h.info()) {
+			return false
+		}
+	}
+	h.pendingInfo = nil
+
+	h.session.Status.Update(func(status *SessionStatus) {
+		status.Player = playerName(h.record.Player, h.handle)
+		status.Level = h.game.Level
+		status.Remaining = h.guesses
+	})
+
+	Spectators.Publish(h.event(nil, false))
+
+	return true
+}
+
+func sanitizeHandle(handle string) string {
+	var sanitized []rune
+	for _, r := range strings.TrimSpace(handle) {
+		if len(sanitized) == maxHandleLength {
+			break
+		}
+		if unicode.IsPrint(r) && r != '#' {
+			sanitized = append(sanitized, r)
 		}
+	}
+
+	return string(sanitized)
+}
+
+func (h *sessionHandler) event(indicators []rune, complete bool) *game.SpectatorEvent {
+	return &game.SpectatorEvent{
+		SessionID:        h.record.ID,
+		Level:            h.game.Level,
+		Length:           h.game.Length(),
+		Guesses:          h.game.Guesses,
+		Indicators:       indicators,
+		RemainingGuesses: h.guesses,
+		Complete:         complete,
+	}
+}
+
+// organiser reports whether the client presented an unrevoked spectator
+// certificate of the CA.
+func (h *sessionHandler) organiser() bool {
+	conn, ok := h.conn.(*tls.Conn)
+	if !ok {
+		return false
+	}
+
+	chains := conn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return false
+	}
+	leaf := chains[0][0]
+
+	return leaf.VerifyHostname(spectatorCertName) == nil && !Certs.IsRevoked(leaf.SerialNumber)
+}
 
-		result := g.ProcessGuess([]rune(req.Data))
-		if len(result.Indicators) > 0 {
-			guesses -= 1
+// spectate streams game events to the client until it disconnects or stops
+// sending keepalives. The data of the request optionally restricts the stream
+// to a single session.
+func (h *sessionHandler) spectate(req sessionRequest) {
+	sessionID := uuid.Nil
+	if req.Data != "" {
+		var err error
+		sessionID, err = uuid.Parse(req.Data)
+		if err != nil {
+			h.sendError(req.ID, "Invalid session to spectate")
+			return
 		}
+	}
 
-		if result.Complete && g.Level < levelCount {
-			completionCert, err := generateCompletionCert(g.Level + 1)
+	err := h.conn.SetDeadline(time.Now().Add(h.cfg.Timeout.Duration))
+	if err != nil {
+		h.log.Error("session.deadline", "failed to set deadline", "error", err)
+		return
+	}
+
+	h.log.Info("session.spectate", "spectating", "spectated", sessionID)
+	h.session.Status.Update(func(status *SessionStatus) {
+		status.Spectating = true
+	})
+	events := Spectators.Subscribe(sessionID)
+	defer Spectators.Unsubscribe(events)
+
+	for {
+		select {
+		case event := <-events:
+			if !h.send(req.ID, event) {
+				return
+			}
+		case <-h.ctx.Done():
+			h.send(0, &game.ShutdownNotice{Message: "Server shutting down"})
+			return
+		case _, ok := <-h.requests:
+			if !ok {
+				return
+			}
+
+			err = h.conn.SetDeadline(time.Now().Add(h.cfg.Timeout.Duration))
 			if err != nil {
-				log.Println("Failed to generate client certificate:", err)
+				h.log.Error("session.deadline", "failed to set deadline", "error", err)
 				return
 			}
-			result.ClientCert = *completionCert
-			result.CompleteMessage = g.CompleteMessage
 		}
+	}
+}
+
+func (h *sessionHandler) info() *game.InfoResult {
+	return &game.InfoResult{
+		Length:     h.game.Length(),
+		Level:      h.game.Level,
+		Guesses:    h.game.Guesses,
+		Candidates: h.game.Candidates,
+		HardMode:   h.game.HardMode,
+		History:    h.game.History,
+		Puzzle:     h.game.Puzzle,
+		Separators: h.game.SeparatorCells(),
+		Graphemes:  h.game.Graphemes,
+		NoHints:    h.game.NoHints,
+		Result:     h.record.Result,
+	}
+}
 
-		result.RemainingGuesses = guesses
+func (h *sessionHandler) guess(req sessionRequest) bool {
+	g := h.game
+
+	start := time.Now()
+	result := g.ProcessGuess([]rune(req.Data))
+	guessLatency.Observe(time.Since(start).Seconds(), levelLabel(g.Level))
+	h.log.Debug("session.guess", "guess processed", "guess", logging.Secret(req.Data), "scored", len(result.Indicators) > 0)
+
+	if len(result.Indicators) > 0 {
+		h.guesses -= 1
+		guessesProcessed.Inc(levelLabel(g.Level), "scored")
+	} else {
+		guessesProcessed.Inc(levelLabel(g.Level), "rejected")
+	}
 
-		err = encoder.Encode(result)
+	next, ok := nextLevel(h.levels, g.Level)
+	if result.Complete && ok {
+		completionCert, err := generateCompletionCert(next, h.record.Player, h.cfg.ClientCertValidity.Duration)
 		if err != nil {
-			return
+			h.log.Error("session.cert", "failed to generate client certificate", "error", err)
+			return false
+		}
+		// A certificate missing from the registry could never be revoked,
+		// so the guess fails before it is saved and can be made again once
+		// the game is resumed.
+		_, err = Certs.Record(completionCert, next, h.record.ID, h.record.Player)
+		if err != nil {
+			h.log.Error("session.cert", "failed to record client certificate", "error", err)
+			h.sendError(req.ID, "Unable to issue the certificate of the next level")
+			return false
 		}
+		result.ClientCert = *completionCert
+		result.CompleteMessage = g.CompleteMessage
+	}
+
+	result.RemainingGuesses = h.guesses
+
+	if result.Complete || h.guesses == 0 {
+		h.record.Result = result
+	}
+	h.record.Remaining = h.guesses
+	h.record.Updated = time.Now()
+	err := Store.Save(h.record)
+	if errors.Is(err, ErrSessionTaken) {
+		h.log.Info("session.guess", "game was resumed by another session")
+		h.sendError(req.ID, err.Error())
+		return false
+	} else if err != nil {
+		h.log.Error("session.store", "failed to update session", "error", err)
+	}
+
+	h.session.Status.Update(func(status *SessionStatus) {
+		status.Remaining = h.guesses
+	})
 
+	if len(result.Indicators) > 0 {
+		Spectators.Publish(h.event(result.Indicators, result.Complete))
+	}
+
+	// Complete messages and answers, which the winning guess is, can hold
+	// flags, they are only transcribed along with the secrets of the log.
+	transcribed := *result
+	transcribed.ClientCert = cert.PemCertPair{}
+	request := req.Request
+	if !h.cfg.LogSecrets {
+		transcribed.CompleteMessage = ""
 		if result.Complete {
-			log.Printf("session %v: level %d complete", id, g.Level)
-			return
+			request.Data = ""
+		}
+	}
+	h.transcribe(game.TranscriptEntry{
+		Event:   game.TranscriptGuess,
+		Request: &request,
+		Guess:   &transcribed,
+	})
+
+	if (result.Complete || h.guesses == 0) && h.cfg.LogSecrets {
+		h.transcribe(game.TranscriptEntry{Event: game.TranscriptAnswer, Answer: string(g.Word)})
+	}
+
+	if result.Complete {
+		h.log.Info("session.complete", "level complete", "guesses", g.Guesses-h.guesses)
+		levelCompletions.Inc(levelLabel(g.Level))
+		guessesToComplete.Observe(float64(g.Guesses-h.guesses), levelLabel(g.Level))
+
+		err = Scores.Record(Completion{
+			Player:    h.record.Player,
+			Handle:    h.handle,
+			Level:     g.Level,
+			Guesses:   g.Guesses - h.guesses,
+			SolveTime: time.Since(h.record.Started),
+			Completed: time.Now(),
+		})
+		if err != nil {
+			h.log.Error("session.scoreboard", "failed to record completion", "error", err)
 		}
+	} else if h.guesses == 0 {
+		h.log.Info("session.failed", "no more guesses")
+		levelFailures.Inc(levelLabel(g.Level))
+	}
 
-		if guesses == 0 {
-			log.Printf("session %v: no more guesses", id)
-			return
+	if !h.send(req.ID, result) {
+		return false
+	}
+
+	return !result.Complete && h.guesses > 0
+}
+
+// playing stops accepting level authentications once the session has a
+// game.
+func (h *sessionHandler) playing() {
+	if h.gameChan != nil {
+		h.gameChan = nil
+		close(h.session.Playing)
+	}
+}
+
+// transcribe writes entry to the transcript of the game, if one is kept. A
+// transcript which fails to be written is given up on rather than ending the
+// game.
+func (h *sessionHandler) transcribe(entry game.TranscriptEntry) {
+	err := h.transcript.Write(entry)
+	if err != nil {
+		h.log.Warn("session.transcript", "failed to write transcript", "error", err)
+		h.transcript.Close()
+		h.transcript = nil
+	}
+}
+
+func (h *sessionHandler) send(id uint64, result interface{ MessageType() game.MessageType }) bool {
+	err := game.WriteMessage(h.encoder, result.MessageType(), id, result)
+	if err != nil {
+		h.log.Warn("session.send", "error sending result", "type", result.MessageType(), "error", err)
+		return false
+	}
+
+	return true
+}
+
+// sendError reports a failed request to the client. It always returns true,
+// the caller decides whether the session survives the error.
+func (h *sessionHandler) sendError(id uint64, message string) bool {
+	h.send(id, &game.ErrorResult{Error: message})
+	return true
+}
+
+// resumeSession takes over the game of a previous session for session owner,
+// checking the resume token and restoring the validator of its level. It also
+// returns the session the game was taken from.
+func resumeSession(data string, levels []*LevelServer, window time.Duration, owner uuid.UUID) (*SessionRecord, uuid.UUID, error) {
+	sessionID, token, err := game.ParseResumeData(data)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	record, err := Store.Load(sessionID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(record.ResumeToken)) != 1 {
+		return nil, uuid.Nil, errors.New("Invalid resume token")
+	}
+
+	if time.Since(record.Updated) > window {
+		Store.Delete(sessionID)
+		return nil, uuid.Nil, errors.New("Session expired")
+	}
+
+	var validator game.GuessValidator
+	for _, l := range levels {
+		if l.Number == record.Game.Level {
+			validator = l.Level().GenerateGame().Validator
 		}
 	}
+	if validator == nil {
+		return nil, uuid.Nil, fmt.Errorf("level %d is no longer available", record.Game.Level)
+	}
+
+	record, err = Store.Take(sessionID, owner)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	previous := record.Owner
+	record.Owner = owner
+	record.Game.Validator = validator
+
+	return record, previous, nil
+}
+
+func generateResumeToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// readRequests decodes requests from the client until the connection fails,
+// a message cannot be read as a request or done is closed.
+func readRequests(decoder *json.Decoder, done chan struct{}) chan sessionRequest {
+	requests := make(chan sessionRequest)
+
+	go func() {
+		defer close(requests)
+
+		for {
+			var req sessionRequest
+
+			envelope, err := game.ReadMessage(decoder)
+			if envelope == nil {
+				return
+			}
+
+			req.ID = envelope.ID
+			if err != nil {
+				req.Err = err
+			} else if envelope.Type != game.MessageRequest {
+				req.Err = fmt.Errorf("unexpected %q message", envelope.Type)
+			} else if err = json.Unmarshal(envelope.Payload, &req.Request); err != nil {
+				req.Err = fmt.Errorf("malformed request: %w", err)
+			}
+
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+
+			if req.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return requests
+}
+
+func levelCatalog(levels []*LevelServer) *game.CatalogResult {
+	catalog := &game.CatalogResult{}
+	for _, l := range levels {
+		catalog.Levels = append(catalog.Levels, l.Info())
+	}
+
+	return catalog
+}
+
+// generateCompletionCert issues the certificate of the next level to a player,
+// who keeps their ID from level to level.
+func generateCompletionCert(level int, player string, validity time.Duration) (*cert.PemCertPair, error) {
+	return generateClientCert(fmt.Sprint(level), player, validity)
 }
 
-func generateCompletionCert(level int) (*cert.PemCertPair, error) {
+// generateClientCert issues a client certificate for name, which is the
+// number of a level or spectatorCertName.
+func generateClientCert(name, player string, validity time.Duration) (*cert.PemCertPair, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
@@ -175,9 +856,10 @@ func generateCompletionCert(level int) (*cert.PemCertPair, error) {
 		IsServer:   false,
 		IsClient:   true,
 		Serial:     serialNumber,
-		CommonName: fmt.Sprint(level),
-		DNSNames:   []string{fmt.Sprint(level)},
-		SecsValid:  60 * 60 * 24,
+		CommonName: name,
+		DNSNames:   []string{name},
+		Player:     player,
+		SecsValid:  uint(validity.Seconds()),
 	})
 	if err != nil {
 		return nil, err
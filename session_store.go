@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/game"
+	"pppordle/logging"
+)
+
+var (
+	ErrSessionNotFound = errors.New("Could not find session")
+	ErrSessionTaken    = errors.New("Game was resumed by another session")
+)
+
+// SessionRecord is the resumable state of a session's game.
+type SessionRecord struct {
+	ID uuid.UUID
+	// Owner is the session playing the game, which is the session it was
+	// started in until it is resumed.
+	Owner       uuid.UUID
+	ResumeToken string
+	Game        *game.Game
+	Remaining   int
+	Player      string
+	Started     time.Time
+	Updated     time.Time
+	// Result is the result of the last guess of a finished game, which is
+	// kept until the resume window is over in case it never reached the
+	// player.
+	Result *game.GuessResult
+}
+
+// SessionStore keeps games alive across dropped connections. Games loaded from
+// a store have no validator, it must be restored from the game's level.
+//
+// A game is played by a single session at a time, its owner. Saves by any
+// other session fail with ErrSessionTaken, so a game resumed elsewhere can't
+// be played on by the connection it was taken from.
+type SessionStore interface {
+	Save(record *SessionRecord) error
+	Load(id uuid.UUID) (*SessionRecord, error)
+	// Take hands the game of session id over to owner. The record is
+	// returned as it was, its Owner being the session it was taken from.
+	Take(id, owner uuid.UUID) (*SessionRecord, error)
+	Delete(id uuid.UUID) error
+	// Sweep removes the records last updated before the given time,
+	// returning how many were removed. Records which fail to be swept are
+	// skipped, the first failure being returned once the others are swept.
+	Sweep(before time.Time) (int, error)
+}
+
+// sessionSweepInterval is how often records which can no longer be resumed
+// are swept from the store.
+const sessionSweepInterval = time.Minute
+
+// sweepSessions removes the records of abandoned sessions once their resume
+// window is over, until ctx is cancelled.
+func sweepSessions(ctx context.Context, window time.Duration, logger *logging.Logger) {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := Store.Sweep(time.Now().Add(-window))
+		if err != nil {
+			logger.Error("session.store", "failed to sweep sessions", "error", err)
+		}
+		if n > 0 {
+			logger.Debug("session.store", "swept expired sessions", "sessions", n)
+		}
+	}
+}
+
+type MemorySessionStore struct {
+	mutex   sync.Mutex
+	records map[uuid.UUID]SessionRecord
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		records: make(map[uuid.UUID]SessionRecord),
+	}
+}
+
+func (s *MemorySessionStore) Save(record *SessionRecord) error {
+	saved := *record
+	g := *record.Game
+	g.History = append([]game.GuessRecord(nil), g.History...)
+	g.Validator = nil
+	saved.Game = &g
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.records[record.ID]
+	if ok && stored.Owner != record.Owner {
+		return ErrSessionTaken
+	}
+	s.records[record.ID] = saved
+
+	return nil
+}
+
+func (s *MemorySessionStore) Load(id uuid.UUID) (*SessionRecord, error) {
+	s.mutex.Lock()
+	saved, ok := s.records[id]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	g := *saved.Game
+	g.History = append([]game.GuessRecord(nil), g.History...)
+	saved.Game = &g
+
+	return &saved, nil
+}
+
+func (s *MemorySessionStore) Take(id, owner uuid.UUID) (*SessionRecord, error) {
+	s.mutex.Lock()
+	saved, ok := s.records[id]
+	if ok {
+		taken := saved
+		taken.Owner = owner
+		s.records[id] = taken
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	g := *saved.Game
+	g.History = append([]game.GuessRecord(nil), g.History...)
+	saved.Game = &g
+
+	return &saved, nil
+}
+
+func (s *MemorySessionStore) Delete(id uuid.UUID) error {
+	s.mutex.Lock()
+	delete(s.records, id)
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *MemorySessionStore) Sweep(before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := 0
+	for id, record := range s.records {
+		if record.Updated.Before(before) {
+			delete(s.records, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// FileSessionStore keeps one JSON document per session in a directory so games
+// survive server restarts. The directory must not be shared by several
+// servers, which could take games from each other unnoticed.
+type FileSessionStore struct {
+	Dir   string
+	mutex sync.Mutex
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session store directory: %w", err)
+	}
+
+	return &FileSessionStore{Dir: dir}, nil
+}
+
+func (s *FileSessionStore) path(id uuid.UUID) string {
+	return filepath.Join(s.Dir, id.String()+".json")
+}
+
+func (s *FileSessionStore) Save(record *SessionRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, err := s.load(record.ID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	if stored != nil && stored.Owner != record.Owner {
+		return ErrSessionTaken
+	}
+
+	return s.write(record)
+}
+
+func (s *FileSessionStore) write(record *SessionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(record.ID))
+}
+
+func (s *FileSessionStore) Load(id uuid.UUID) (*SessionRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.load(id)
+}
+
+func (s *FileSessionStore) load(id uuid.UUID) (*SessionRecord, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var record SessionRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	if record.Game == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	return &record, nil
+}
+
+func (s *FileSessionStore) Take(id, owner uuid.UUID) (*SessionRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := *record
+	taken.Owner = owner
+	err = s.write(&taken)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (s *FileSessionStore) Delete(id uuid.UUID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.remove(id)
+}
+
+func (s *FileSessionStore) remove(id uuid.UUID) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *FileSessionStore) Sweep(before time.Time) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var failed error
+	for _, path := range paths {
+		id, err := uuid.Parse(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+
+		swept, err := s.sweep(id, before)
+		if err != nil && failed == nil {
+			failed = fmt.Errorf("failed to sweep session %s: %w", id, err)
+		}
+		if swept {
+			n++
+		}
+	}
+
+	return n, failed
+}
+
+func (s *FileSessionStore) sweep(id uuid.UUID, before time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, err := s.load(id)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return false, err
+	}
+	if record != nil && !record.Updated.Before(before) {
+		return false, nil
+	}
+
+	err = s.remove(id)
+	return err == nil, err
+}
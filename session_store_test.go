@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/game"
+	"pppordle/server/level"
+)
+
+func testStores(t *testing.T) map[string]SessionStore {
+	files, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   files,
+	}
+}
+
+func testRecord(updated time.Time) *SessionRecord {
+	id := uuid.New()
+	return &SessionRecord{
+		ID:          id,
+		Owner:       id,
+		ResumeToken: "token",
+		Game: &game.Game{
+			Word:    []rune("CRANE"),
+			Level:   1,
+			Guesses: 6,
+			History: []game.GuessRecord{{Guess: "SLATE", Indicators: []rune("⬛⬛🟩⬛🟩")}},
+		},
+		Remaining: 5,
+		Updated:   updated,
+	}
+}
+
+func TestSessionStoreOwnership(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			record := testRecord(time.Now())
+			original := record.Owner
+			err := store.Save(record)
+			if err != nil {
+				t.Fatalf("Save() = %v", err)
+			}
+
+			resumer := uuid.New()
+			taken, err := store.Take(record.ID, resumer)
+			if err != nil {
+				t.Fatalf("Take() = %v", err)
+			}
+			if taken.Owner != original {
+				t.Errorf("Take() returned owner %v, want the previous owner %v", taken.Owner, original)
+			}
+			if len(taken.Game.History) != 1 {
+				t.Errorf("Take() returned %d guesses, want 1", len(taken.Game.History))
+			}
+
+			steps := []struct {
+				name  string
+				owner uuid.UUID
+				err   error
+			}{
+				{"previous owner", original, ErrSessionTaken},
+				{"new owner", resumer, nil},
+				{"unrelated session", uuid.New(), ErrSessionTaken},
+			}
+			for _, step := range steps {
+				saved := *record
+				saved.Owner = step.owner
+				saved.Remaining = 4
+				err := store.Save(&saved)
+				if !errors.Is(err, step.err) {
+					t.Errorf("Save() by the %s = %v, want %v", step.name, err, step.err)
+				}
+			}
+
+			loaded, err := store.Load(record.ID)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if loaded.Owner != resumer || loaded.Remaining != 4 {
+				t.Errorf("Load() = owner %v with %d guesses left, want %v with 4", loaded.Owner, loaded.Remaining, resumer)
+			}
+
+			_, err = store.Take(uuid.New(), resumer)
+			if !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Take() of an unknown session = %v, want %v", err, ErrSessionNotFound)
+			}
+		})
+	}
+}
+
+func TestSessionStoreSweep(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			stale := testRecord(time.Now().Add(-time.Hour))
+			fresh := testRecord(time.Now())
+			for _, record := range []*SessionRecord{stale, fresh} {
+				err := store.Save(record)
+				if err != nil {
+					t.Fatalf("Save() = %v", err)
+				}
+			}
+
+			n, err := store.Sweep(time.Now().Add(-time.Minute))
+			if err != nil || n != 1 {
+				t.Fatalf("Sweep() = %d, %v, want 1 record swept", n, err)
+			}
+			if _, err := store.Load(stale.ID); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("stale record still loads: %v", err)
+			}
+			if _, err := store.Load(fresh.ID); err != nil {
+				t.Errorf("fresh record swept: %v", err)
+			}
+		})
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	validator := func(g *game.Game, guess []rune) error { return nil }
+	levels := []*LevelServer{{
+		Number: 1,
+		level: &level.Level{
+			Number:       1,
+			GenerateGame: func() *game.Game { return &game.Game{Level: 1, Validator: validator} },
+		},
+	}}
+
+	defer func(store SessionStore) { Store = store }(Store)
+	Store = NewMemorySessionStore()
+
+	live := testRecord(time.Now())
+	expired := testRecord(time.Now().Add(-time.Hour))
+	retired := testRecord(time.Now())
+	retired.Game.Level = 2
+	for _, record := range []*SessionRecord{live, expired, retired} {
+		err := Store.Save(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"malformed", live.ID.String(), "improperly formatted resume request"},
+		{"unknown session", game.ResumeData(uuid.New(), "token"), ErrSessionNotFound.Error()},
+		{"wrong token", game.ResumeData(live.ID, "guess"), "Invalid resume token"},
+		{"expired", game.ResumeData(expired.ID, "token"), "Session expired"},
+		{"level gone", game.ResumeData(retired.ID, "token"), "level 2 is no longer available"},
+		{"resumed", game.ResumeData(live.ID, "token"), ""},
+		{"resumed again", game.ResumeData(live.ID, "token"), ""},
+	}
+
+	previous := live.Owner
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			owner := uuid.New()
+			record, taken, err := resumeSession(test.data, levels, time.Minute, owner)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("resumeSession() = %v, want %q", err, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resumeSession() = %v", err)
+			}
+			if record.Owner != owner || taken != previous {
+				t.Errorf("game taken from %v by %v, want from %v by %v", taken, record.Owner, previous, owner)
+			}
+			if record.Game.Validator == nil {
+				t.Errorf("resumed game has no validator")
+			}
+			previous = owner
+		})
+	}
+
+	if _, err := Store.Load(expired.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expired session still stored: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pppordle/game"
+)
+
+// Transcript records a game as JSON lines, one game.TranscriptEntry per line,
+// in a file named after the session the game was started in. Resumed games
+// carry on in the transcript they started. A nil Transcript records nothing.
+type Transcript struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func OpenTranscript(dir string, id uuid.UUID) (*Transcript, error) {
+	f, err := os.OpenFile(filepath.Join(dir, id.String()+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transcript{
+		file:    f,
+		encoder: json.NewEncoder(f),
+	}, nil
+}
+
+// Write appends entry to the transcript, stamped with the current time.
+func (t *Transcript) Write(entry game.TranscriptEntry) error {
+	if t == nil {
+		return nil
+	}
+
+	entry.Time = time.Now()
+	return t.encoder.Encode(&entry)
+}
+
+func (t *Transcript) Close() error {
+	if t == nil {
+		return nil
+	}
+
+	return t.file.Close()
+}
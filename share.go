@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var shareFile string
+
+// shareGrid returns the spoiler free summary of a finished game, e.g.
+//
+//	PPPORDLE L1 4/6
+//
+//	⬛🟨⬛⬛⬛
+//	...
+func shareGrid(state *State) string {
+	score := "X"
+	if state.Solved {
+		score = fmt.Sprint(len(state.History))
+	}
+
+	header := fmt.Sprintf("PPPORDLE L%d", state.Level)
+	if state.Puzzle > 0 {
+		header += fmt.Sprintf(" #%d", state.Puzzle)
+	}
+
+	var grid strings.Builder
+	fmt.Fprintf(&grid, "%s %s/%d\n\n", header, score, state.Guesses)
+	for _, indicators := range state.History {
+		grid.WriteString(string(indicators))
+		grid.WriteByte('\n')
+	}
+
+	return grid.String()
+}
+
+// copyToClipboard sets the clipboard of the terminal with an OSC 52 escape
+// sequence, which also works over SSH. Terminals which don't support it
+// ignore it.
+func copyToClipboard(text string) error {
+	_, err := fmt.Fprintf(os.Stdout, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+func saveShareGrid(text string) error {
+	return os.WriteFile(shareFile, []byte(text), 0644)
+}
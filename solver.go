@@ -0,0 +1,351 @@
+package client
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strings"
+
+	"pppordle/game"
+)
+
+// Sizes of the samples Suggest scores guesses on, which bound its cost on long
+// wordlists.
+const (
+	suggestGuesses = 300
+	suggestAnswers = 500
+)
+
+// Solver keeps track of the answers consistent with the feedback of a game
+// and suggests guesses. With a wordlist it tracks the words of the list which
+// are still possible, otherwise only what is known of every letter.
+type Solver struct {
+	length     int
+	alphabet   []string
+	cells      []rune // separator of every cell, 0 for letters
+	separators []rune
+	graphemes  bool
+	hardMode   bool
+
+	guessable [][]string
+	words     [][]string // remaining answers, nil without a wordlist
+	feedback  []feedback
+}
+
+type feedback struct {
+	guess      []string
+	indicators []rune
+}
+
+// ReadWordlist reads a word per line, upper cased.
+func ReadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToUpper(strings.TrimSpace(scanner.Text()))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+
+	return words, scanner.Err()
+}
+
+// NewSolver creates a solver of the game described by info. The words of
+// wordlist which can't be played in the game are left out, without any the
+// solver only tracks constraints.
+func NewSolver(info *game.InfoResult, wordlist []string) *Solver {
+	s := &Solver{
+		length:    info.Length,
+		alphabet:  info.Candidates,
+		cells:     info.Separators,
+		graphemes: info.Graphemes,
+		hardMode:  info.HardMode,
+	}
+	for _, c := range info.Separators {
+		if c != 0 {
+			s.separators = append(s.separators, c)
+		}
+	}
+
+	inAlphabet := make(map[string]bool)
+	for _, l := range s.alphabet {
+		inAlphabet[l] = true
+	}
+
+word:
+	for _, w := range wordlist {
+		letters := game.SplitLetters(w, s.graphemes)
+		if len(letters) != s.length {
+			continue
+		}
+		for i, l := range letters {
+			if s.isSeparator(i) && l != string(s.cells[i]) || !s.isSeparator(i) && !inAlphabet[l] {
+				continue word
+			}
+		}
+		s.guessable = append(s.guessable, letters)
+	}
+	if len(s.guessable) > 0 {
+		s.words = s.guessable
+	}
+
+	for _, record := range info.History {
+		s.Add(record.Guess, record.Indicators)
+	}
+
+	return s
+}
+
+func (s *Solver) isSeparator(i int) bool {
+	return i < len(s.cells) && s.cells[i] != 0
+}
+
+// Add narrows the possible answers down with the feedback of a guess.
+func (s *Solver) Add(guess string, indicators []rune) {
+	f := feedback{
+		guess:      s.expand(game.SplitLetters(guess, s.graphemes)),
+		indicators: indicators,
+	}
+	s.feedback = append(s.feedback, f)
+
+	if s.words == nil {
+		return
+	}
+
+	var words [][]string
+	for _, w := range s.words {
+		if string(game.Score(w, f.guess, s.separators)) == string(f.indicators) {
+			words = append(words, w)
+		}
+	}
+	s.words = words
+}
+
+// expand fills in the separators of a guess which only has the letters.
+func (s *Solver) expand(guess []string) []string {
+	if len(guess) == s.length {
+		return guess
+	}
+
+	expanded := make([]string, 0, s.length)
+	for i := 0; i < s.length; i++ {
+		if s.isSeparator(i) || len(guess) == 0 {
+			expanded = append(expanded, string(s.cells[i]))
+			continue
+		}
+
+		expanded = append(expanded, guess[0])
+		guess = guess[1:]
+	}
+
+	return expanded
+}
+
+// Remaining returns the number of possible answers, which is an upper bound
+// rather than exact without a wordlist.
+func (s *Solver) Remaining() (n int, exact bool) {
+	if s.words != nil {
+		return len(s.words), true
+	}
+
+	allowed, _ := s.constraints()
+	count := 1.0
+	for _, letters := range allowed {
+		if letters != nil {
+			count *= float64(len(letters))
+		}
+	}
+
+	return int(math.Min(count, math.MaxInt32)), false
+}
+
+// constraints returns the letters each cell may still hold, nil for
+// separators, and the number of times each letter is known to appear.
+func (s *Solver) constraints() ([]map[string]bool, map[string]int) {
+	allowed := make([]map[string]bool, s.length)
+	for i := range allowed {
+		if s.isSeparator(i) {
+			continue
+		}
+
+		allowed[i] = make(map[string]bool)
+		for _, l := range s.alphabet {
+			allowed[i][l] = true
+		}
+	}
+
+	required := make(map[string]int)
+	absent := make(map[string]bool)
+	for _, f := range s.feedback {
+		present := make(map[string]int)
+		for i, indicator := range f.indicators {
+			if s.isSeparator(i) || i >= len(f.guess) {
+				continue
+			}
+
+			l := f.guess[i]
+			switch indicator {
+			case '🟩':
+				allowed[i] = map[string]bool{l: true}
+				present[l]++
+			case '🟨':
+				delete(allowed[i], l)
+				present[l]++
+			default:
+				delete(allowed[i], l)
+				absent[l] = true
+			}
+		}
+
+		for l, n := range present {
+			if n > required[l] {
+				required[l] = n
+			}
+		}
+	}
+
+	// A letter marked absent without any other copy marked present isn't in
+	// the word at all.
+	for l := range absent {
+		if required[l] > 0 {
+			continue
+		}
+		for _, letters := range allowed {
+			if len(letters) > 1 {
+				delete(letters, l)
+			}
+		}
+	}
+
+	return allowed, required
+}
+
+// Suggest returns the guess expected to tell the most about the answer.
+func (s *Solver) Suggest() string {
+	if s.words == nil {
+		return s.suggestLetters()
+	}
+	if len(s.words) == 0 {
+		return ""
+	}
+	if len(s.words) <= 2 {
+		return strings.Join(s.words[0], "")
+	}
+
+	// Hard mode only accepts guesses keeping the green letters in place and
+	// holding the yellow ones. The remaining answers all do, so only they are
+	// suggested rather than checking every guessable word.
+	answers := sample(s.words, suggestAnswers)
+	var guesses [][]string
+	if !s.hardMode {
+		guesses = append(guesses, sample(s.guessable, suggestGuesses)...)
+	}
+	guesses = append(guesses, sample(s.words, suggestGuesses)...)
+
+	possible := make(map[string]bool)
+	for _, w := range s.words {
+		possible[strings.Join(w, "")] = true
+	}
+
+	best, bestScore := "", -1.0
+	for _, guess := range guesses {
+		patterns := make(map[string]int)
+		for _, answer := range answers {
+			patterns[string(game.Score(answer, guess, s.separators))]++
+		}
+
+		// The expected information of the feedback, in bits, with a
+		// little extra for guesses which may be the answer.
+		score := 0.0
+		for _, n := range patterns {
+			p := float64(n) / float64(len(answers))
+			score -= p * math.Log2(p)
+		}
+		word := strings.Join(guess, "")
+		if possible[word] {
+			score += 1 / float64(len(s.words))
+		}
+
+		if score > bestScore {
+			best, bestScore = word, score
+		}
+	}
+
+	return best
+}
+
+// suggestLetters builds a guess without a wordlist. Known letters are kept,
+// letters known to be in the word are moved to cells they haven't been tried
+// in and the remaining cells get letters which haven't been tried yet.
+func (s *Solver) suggestLetters() string {
+	allowed, required := s.constraints()
+
+	tried := make(map[string]bool)
+	for _, f := range s.feedback {
+		for _, l := range f.guess {
+			tried[l] = true
+		}
+	}
+
+	used := make(map[string]int)
+	guess := make([]string, s.length)
+	for i, letters := range allowed {
+		if letters == nil {
+			guess[i] = string(s.cells[i])
+		} else if len(letters) == 1 {
+			for l := range letters {
+				guess[i] = l
+				used[l]++
+			}
+		}
+	}
+
+	// Preferred letters come first: letters known to be in the word, then
+	// untried letters, then unused ones.
+	preferences := []func(l string) bool{
+		func(l string) bool { return used[l] < required[l] },
+		func(l string) bool { return !tried[l] && used[l] == 0 },
+		func(l string) bool { return used[l] == 0 },
+		func(l string) bool { return true },
+	}
+
+	for i := range guess {
+		if guess[i] != "" {
+			continue
+		}
+
+	pick:
+		for _, preferred := range preferences {
+			for _, l := range s.alphabet {
+				if allowed[i][l] && preferred(l) {
+					guess[i] = l
+					used[l]++
+					break pick
+				}
+			}
+		}
+	}
+
+	return strings.Join(guess, "")
+}
+
+// sample returns up to n words evenly spread over words.
+func sample(words [][]string, n int) [][]string {
+	if len(words) <= n {
+		return words
+	}
+
+	sampled := make([][]string, n)
+	for i := range sampled {
+		sampled[i] = words[i*len(words)/n]
+	}
+
+	return sampled
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"pppordle/game"
+)
+
+// spectatorBuffer is the number of events a slow spectator may fall behind
+// before events are dropped for it.
+const spectatorBuffer = 64
+
+// spectatorCertName is the name of the client certificates which let
+// organisers spectate, see the spectator-cert admin command.
+const spectatorCertName = "spectator"
+
+var Spectators = NewSpectatorHub()
+
+// SpectatorHub fans game events out to spectator connections.
+type SpectatorHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan *game.SpectatorEvent]uuid.UUID
+}
+
+func NewSpectatorHub() *SpectatorHub {
+	return &SpectatorHub{
+		subscribers: make(map[chan *game.SpectatorEvent]uuid.UUID),
+	}
+}
+
+// Subscribe returns a channel of the events of one session, or of every
+// session when sessionID is uuid.Nil.
+func (hub *SpectatorHub) Subscribe(sessionID uuid.UUID) chan *game.SpectatorEvent {
+	events := make(chan *game.SpectatorEvent, spectatorBuffer)
+
+	hub.mutex.Lock()
+	hub.subscribers[events] = sessionID
+	hub.mutex.Unlock()
+
+	return events
+}
+
+func (hub *SpectatorHub) Unsubscribe(events chan *game.SpectatorEvent) {
+	hub.mutex.Lock()
+	delete(hub.subscribers, events)
+	hub.mutex.Unlock()
+}
+
+// Publish never blocks, spectators which are not keeping up miss events.
+func (hub *SpectatorHub) Publish(event *game.SpectatorEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for events, sessionID := range hub.subscribers {
+		if sessionID != uuid.Nil && sessionID != event.SessionID {
+			continue
+		}
+
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/rivo/tview"
+
+	"pppordle/game"
+)
+
+// maxSpectatorBoards is the number of games shown side by side, older games
+// make way for new ones.
+const maxSpectatorBoards = 6
+
+type spectatorBoard struct {
+	SessionID uuid.UUID
+	Grid      *tview.Grid
+	Header    *tview.TextView
+	Cells     []*tview.Button
+	Length    int
+	Row       int
+}
+
+func startSpectatorUI(sessionID string) {
+	var boards []*spectatorBoard
+
+	status := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetText("Waiting for games...")
+	status.SetBackgroundColor(colorBlack)
+
+	boardFlex := tview.NewFlex()
+	boardFlex.SetBackgroundColor(colorBlack)
+
+	grid := tview.NewGrid().
+		SetRows(1, 3, 1, 0, 1).
+		SetColumns(0, 50, 0).
+		SetBorders(false).
+		SetGap(1, 1).
+		AddItem(title(), 1, 1, 1, 1, 0, 0, false).
+		AddItem(status, 2, 0, 1, 3, 0, 0, false).
+		AddItem(boardFlex, 3, 0, 1, 3, 0, 0, false)
+
+	events := make(chan *game.SpectatorEvent)
+	go func() {
+		for {
+			err := player.Spectate(sessionID, events)
+			log.Println(err)
+			app.QueueUpdateDraw(func() {
+				status.SetText(fmt.Sprintf("%v, reconnecting...", err))
+			})
+			time.Sleep(3 * time.Second)
+		}
+	}()
+
+	go func() {
+		for event := range events {
+			event := event
+			app.QueueUpdateDraw(func() {
+				status.SetText("Spectating")
+
+				var board *spectatorBoard
+				for _, b := range boards {
+					if b.SessionID == event.SessionID {
+						board = b
+					}
+				}
+
+				if board == nil {
+					board = newSpectatorBoard(event)
+					boards = append(boards, board)
+					boardFlex.AddItem(board.Grid, 0, 1, false)
+
+					if len(boards) > maxSpectatorBoards {
+						boardFlex.RemoveItem(boards[0].Grid)
+						boards = boards[1:]
+					}
+				}
+
+				board.Update(event)
+			})
+		}
+	}()
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			app.Stop()
+			return nil
+		}
+
+		return event
+	})
+
+	err := app.SetRoot(grid, true).Run()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newSpectatorBoard(event *game.SpectatorEvent) *spectatorBoard {
+	board := &spectatorBoard{
+		SessionID: event.SessionID,
+		Header:    tview.NewTextView().SetTextAlign(tview.AlignCenter),
+		Length:    event.Length,
+	}
+	board.Header.SetBackgroundColor(colorBlack)
+
+	rows := make([]int, event.Guesses+1)
+	rows[0] = 1
+	columns := make([]int, event.Length)
+
+	board.Grid = tview.NewGrid().
+		SetRows(rows...).
+		SetColumns(columns...).
+		SetBorders(false).
+		SetGap(1, 1).
+		AddItem(board.Header, 0, 0, 1, event.Length, 0, 0, false)
+	board.Grid.SetBackgroundColor(colorBlack)
+
+	for i := 0; i < event.Guesses; i++ {
+		for j := 0; j < event.Length; j++ {
+			cell := tview.NewButton("")
+			cell.SetBackgroundColor(colorGray)
+			board.Cells = append(board.Cells, cell)
+			board.Grid.AddItem(cell, i+1, j, 1, 1, 0, 0, false)
+		}
+	}
+
+	return board
+}
+
+func (board *spectatorBoard) Update(event *game.SpectatorEvent) {
+	if len(event.Indicators) > 0 && board.Row*board.Length < len(board.Cells) {
+		row := board.Cells[board.Row*board.Length : (board.Row+1)*board.Length]
+		for i, indicator := range event.Indicators {
+			if i < len(row) {
+				row[i].SetBackgroundColor(indicatorColor(indicator))
+			}
+		}
+		board.Row += 1
+	}
+
+	state := fmt.Sprintf("%d left", event.RemainingGuesses)
+	if event.Complete {
+		state = "solved"
+	} else if event.RemainingGuesses == 0 {
+		state = "failed"
+	}
+
+	board.Header.SetText(fmt.Sprintf("Level %d · %s · %s",
+		event.Level, event.SessionID.String()[:8], state))
+}
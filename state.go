@@ -1,25 +1,33 @@
 package main
 
 import (
-	"net"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+
+	"pppordle/pkg/client"
 )
 
 type State struct {
 	Guesses     int
 	WordLen     int
-	Conn        net.Conn
+	Session     client.Session
+	Solver      *client.Solver // nil when the level disables hints
 	GuessIndex  int
 	LetterIndex int
 	Letters     []*tview.Button
 	Level       int
 	Complete    bool
+	Solved      bool
+	Puzzle      int
+	History     [][]rune // indicators of every scored guess
+	Separators  []rune   // separator of every cell, 0 for letters
+	Graphemes   bool     // letters are grapheme clusters
 	Message     *tview.Button
 	AlertChan   chan bool
-	Candidates  map[rune]*tview.Button
+	Candidates  map[string]*tview.Button
 }
 
 func (state *State) CurrentLetters() []*tview.Button {
@@ -32,6 +40,28 @@ func (state *State) CurrentLetter() *tview.Button {
 	return state.Letters[(state.GuessIndex*state.WordLen)+state.LetterIndex]
 }
 
+// LetterLabel returns the letter in cell i of the current guess, without its
+// style tag.
+func (state *State) LetterLabel(i int) string {
+	return strings.TrimPrefix(state.CurrentLetters()[i].GetLabel(), "[::b]")
+}
+
+func (state *State) isSeparator(i int) bool {
+	return i < len(state.Separators) && state.Separators[i] != 0
+}
+
+// seekLetter returns the first cell from i, moving by step, which takes a
+// letter rather than a separator, or -1 if there is none.
+func (state *State) seekLetter(i, step int) int {
+	for ; i >= 0 && i < state.WordLen; i += step {
+		if !state.isSeparator(i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
 func (state *State) SetMessage(message string, fadeout bool) {
 	state.Message.SetLabel("[::b]" + message)
 	state.AlertChan <- fadeout
@@ -81,28 +111,22 @@ func (state *State) MessageFadeOut(stopChan chan struct{}, fadeout bool) {
 }
 
 func (state *State) UpdateIndicators(indicators []rune) {
-	letters := state.CurrentLetters()
 	for i, indicator := range indicators {
+		if state.isSeparator(i) {
+			continue
+		}
 		state.LetterIndex = i
 
-		color := colorBlack
-		switch indicator {
-		case '🟩':
-			color = colorGreen
-		case '🟨':
-			color = colorYellow
-		case '⬛':
-			color = colorLightGray
-		}
+		color := indicatorColor(indicator)
 
 		state.CurrentLetter().SetBackgroundColor(color)
 		state.CurrentLetter().SetBackgroundColorActivated(color)
 		state.CurrentLetter().SetLabelColor(colorBlack)
 		state.CurrentLetter().SetLabelColorActivated(colorBlack)
 
-		label := []rune(letters[i].GetLabel())
-		if len(label) == 6 {
-			c, ok := state.Candidates[label[5]]
+		label := state.LetterLabel(i)
+		if label != "" {
+			c, ok := state.Candidates[label]
 			if ok {
 				prevColor := c.GetBackgroundColor()
 				switch prevColor {
@@ -124,3 +148,16 @@ func (state *State) UpdateIndicators(indicators []rune) {
 		}
 	}
 }
+
+func indicatorColor(indicator rune) tcell.Color {
+	switch indicator {
+	case '🟩':
+		return colorGreen
+	case '🟨':
+		return colorYellow
+	case '⬛':
+		return colorLightGray
+	}
+
+	return colorBlack
+}
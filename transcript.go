@@ -0,0 +1,49 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Events of a transcript entry.
+const (
+	TranscriptInit   = "init"
+	TranscriptInfo   = "info"
+	TranscriptGuess  = "guess"
+	TranscriptAnswer = "answer"
+)
+
+// TranscriptEntry is a line of a game transcript, which the session server
+// can write as games are played and the client can replay. Tokens and client
+// certificates are left out of the results, complete messages, answers and
+// the winning guess unless the server logs secrets.
+type TranscriptEntry struct {
+	Event   string
+	Time    time.Time
+	Init    *InitResult  `json:",omitempty"`
+	Info    *InfoResult  `json:",omitempty"`
+	Request *Request     `json:",omitempty"`
+	Guess   *GuessResult `json:",omitempty"`
+	// Answer is only written once the game is over, by servers logging
+	// secrets.
+	Answer string `json:",omitempty"`
+}
+
+// ReadTranscript reads the entries of a transcript.
+func ReadTranscript(r io.Reader) ([]TranscriptEntry, error) {
+	var entries []TranscriptEntry
+	decoder := json.NewDecoder(r)
+	for {
+		var entry TranscriptEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+}
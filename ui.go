@@ -3,14 +3,17 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"github.com/rivo/uniseg"
 
 	"pppordle/check"
 	"pppordle/game"
+	"pppordle/pkg/client"
 )
 
 var (
@@ -29,6 +32,7 @@ var (
 func startUI() {
 	pages.SetBackgroundColor(colorBlack)
 	pages.AddPage("Level Selector", levelSelector(pages), true, true)
+	go loadLevelSelector()
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEscape {
@@ -37,8 +41,7 @@ func startUI() {
 				app.Stop()
 				return nil
 			} else {
-				pages.RemovePage("Level")
-				pages.SwitchToPage("Level Selector")
+				switchToLevelSelector()
 				return nil
 			}
 		}
@@ -62,13 +65,105 @@ func levelSelector(pages *tview.Pages) tview.Primitive {
 		SetGap(1, 1)
 
 	selector := tview.NewModal().
-		SetText("Level Selector").
-		AddButtons([]string{"1", "2", "3", "4"}).
+		SetText("Loading levels...").
+		SetBackgroundColor(colorGreen)
+
+	grid.AddItem(title(), 1, 1, 1, 1, 0, 0, false)
+	grid.AddItem(selector, 2, 1, 1, 1, 0, 0, true)
+
+	return grid
+}
+
+// loadLevelSelector fetches the level catalog from the server and replaces the
+// level selector with one listing its levels.
+func loadLevelSelector() {
+	catalog, err := fetchCatalog()
+	if err != nil {
+		log.Println(err)
+		app.QueueUpdateDraw(func() {
+			pages.AddPage("Level Selector", catalogError(err), true, true)
+		})
+		return
+	}
+	log.Printf("received level catalog: %+v", catalog)
+
+	app.QueueUpdateDraw(func() {
+		pages.AddPage("Level Selector", catalogSelector(catalog), true, true)
+	})
+}
+
+func switchToLevelSelector() {
+	pages.RemovePage("Level")
+	pages.RemovePage("Leaderboard")
+	pages.SwitchToPage("Level Selector")
+	go loadLevelSelector()
+}
+
+func catalogError(err error) tview.Primitive {
+	grid := tview.NewGrid().
+		SetRows(0, 5, 30, 0).
+		SetColumns(0, 80, 0).
+		SetBorders(false).
+		SetGap(1, 1)
+
+	errorModal := tview.NewModal().
+		SetText(err.Error()).
+		AddButtons([]string{"Retry"}).
+		SetBackgroundColor(colorRed).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			go loadLevelSelector()
+		})
+
+	grid.AddItem(title(), 1, 1, 1, 1, 0, 0, false)
+	grid.AddItem(errorModal, 2, 1, 1, 1, 0, 0, true)
+
+	return grid
+}
+
+func catalogSelector(catalog *game.CatalogResult) tview.Primitive {
+	grid := tview.NewGrid().
+		SetRows(0, 5, 30, 0).
+		SetColumns(0, 80, 0).
+		SetBorders(false).
+		SetGap(1, 1)
+
+	text := "Level Selector\n"
+	var buttons []string
+	for _, l := range catalog.Levels {
+		lock := "🔒"
+		if l.Unlocked {
+			lock = "🔓"
+		}
+		buttons = append(buttons, fmt.Sprintf("%s %d", lock, l.Number))
+		text += fmt.Sprintf("\n%s %d. %s: %s (%d letters, %d symbols)",
+			lock, l.Number, tview.Escape(l.Name), tview.Escape(l.Description), l.Length, l.AlphabetSize)
+		if l.HardMode {
+			text += tview.Escape(" [hard mode]")
+		}
+		if l.Daily {
+			text += tview.Escape(" [daily]")
+		}
+	}
+
+	buttons = append(buttons, "🏆 Leaderboard")
+
+	selector := tview.NewModal().
+		SetText(text).
+		AddButtons(buttons).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonIndex == len(catalog.Levels) {
+				go showLeaderboard()
+				return
+			}
+			if buttonIndex < 0 || buttonIndex >= len(catalog.Levels) {
+				return
+			}
+			info := catalog.Levels[buttonIndex]
+
 			var level tview.Primitive
-			loading, loadingText := loading(buttonIndex + 1)
+			loading, loadingText := loading(info.Number)
 			go func() {
-				level = generateLevel(buttonIndex+1, loadingText)
+				level = generateLevel(info, loadingText)
 				app.QueueUpdateDraw(func() {
 					pages.AddAndSwitchToPage("Level", level, true)
 				})
@@ -83,6 +178,71 @@ func levelSelector(pages *tview.Pages) tview.Primitive {
 	return grid
 }
 
+func showLeaderboard() {
+	leaderboard, err := fetchLeaderboard()
+	if err != nil {
+		log.Println(err)
+		app.QueueUpdateDraw(func() {
+			errorModal := tview.NewModal().
+				SetText(err.Error()).
+				AddButtons([]string{"Ok"}).
+				SetBackgroundColor(colorRed).
+				SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+					switchToLevelSelector()
+				})
+			pages.AddAndSwitchToPage("Leaderboard", errorModal, true)
+		})
+		return
+	}
+
+	app.QueueUpdateDraw(func() {
+		pages.AddAndSwitchToPage("Leaderboard", leaderboardPage(leaderboard), true)
+	})
+}
+
+func leaderboardPage(leaderboard *game.LeaderboardResult) tview.Primitive {
+	table := tview.NewTable().
+		SetBorders(false).
+		SetFixed(1, 0)
+	table.SetBackgroundColor(colorBlack)
+
+	for i, heading := range []string{"Rank", "Player", "Levels", "Guesses", "Time"} {
+		table.SetCell(0, i, tview.NewTableCell("[::b]"+heading).
+			SetTextColor(colorGreen).
+			SetExpansion(1))
+	}
+
+	for i, entry := range leaderboard.Entries {
+		row := []string{
+			fmt.Sprint(entry.Rank),
+			tview.Escape(entry.Player),
+			fmt.Sprint(entry.Levels),
+			fmt.Sprint(entry.Guesses),
+			entry.SolveTime.Round(time.Second).String(),
+		}
+		for j, value := range row {
+			table.SetCell(i+1, j, tview.NewTableCell(value).
+				SetTextColor(colorWhite).
+				SetExpansion(1))
+		}
+	}
+
+	if len(leaderboard.Entries) == 0 {
+		table.SetCell(1, 0, tview.NewTableCell("No levels solved yet").SetTextColor(colorWhite))
+	}
+
+	grid := tview.NewGrid().
+		SetRows(0, 5, 30, 0).
+		SetColumns(0, 80, 0).
+		SetBorders(false).
+		SetGap(1, 1)
+
+	grid.AddItem(title(), 1, 1, 1, 1, 0, 0, false)
+	grid.AddItem(table, 2, 1, 1, 1, 0, 0, true)
+
+	return grid
+}
+
 func title() tview.Primitive {
 	titleText := "PPPORDLE"
 	grid := tview.NewGrid().
@@ -132,23 +292,22 @@ func loading(level int) (tview.Primitive, *tview.TextView) {
 	return modal(tv, 40, 5), tv
 }
 
-func generateLevel(level int, loadingText *tview.TextView) tview.Primitive {
+func generateLevel(level game.LevelInfo, loadingText *tview.TextView) tview.Primitive {
 	errorModal := tview.NewModal().
 		AddButtons([]string{"Ok"}).
 		SetBackgroundColor(colorRed).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-			pages.RemovePage("Level")
-			pages.SwitchToPage("Level Selector")
+			switchToLevelSelector()
 		})
 
-	conn, err := startSession(level, loadingText)
+	session, err := startGame(level, loadingText)
 	if err != nil {
 		log.Println(err)
 		errorModal.SetText(err.Error())
 		return errorModal
 	}
 
-	infoResult, err := makeRequest[*game.InfoResult](conn, game.Request{Type: game.RequestInfo})
+	infoResult, err := session.Info()
 	if err != nil {
 		log.Println(err)
 		errorModal.SetText(err.Error())
@@ -156,17 +315,31 @@ func generateLevel(level int, loadingText *tview.TextView) tview.Primitive {
 	}
 	log.Printf("received game info result: %+v", infoResult)
 
+	grid, state := newBoard(session, infoResult)
+	grid.SetInputCapture(gameboardInputHandler(state))
+
+	return grid
+}
+
+// newBoard builds the board of a game, in which session plays the guesses.
+func newBoard(session client.Session, infoResult *game.InfoResult) (*tview.Grid, *State) {
 	candidateMap, candidateButtons := buildCandidates(infoResult.Candidates)
-	state := State{
-		Guesses:     infoResult.Guesses,
-		WordLen:     infoResult.Length,
-		Conn:        conn,
-		GuessIndex:  0,
-		LetterIndex: 0,
-		Level:       level,
-		Candidates:  candidateMap,
+	state := &State{
+		Guesses:    infoResult.Guesses,
+		WordLen:    infoResult.Length,
+		Session:    session,
+		GuessIndex: 0,
+		Level:      infoResult.Level,
+		Puzzle:     infoResult.Puzzle,
+		Separators: infoResult.Separators,
+		Graphemes:  infoResult.Graphemes,
+		Candidates: candidateMap,
+	}
+	if !infoResult.NoHints {
+		state.Solver = client.NewSolver(infoResult, hintWords)
 	}
 
+	state.LetterIndex = state.seekLetter(0, 1)
 	scale := 50 / state.WordLen
 
 	var guessRows = make([]int, state.Guesses+6)
@@ -192,6 +365,22 @@ func generateLevel(level int, loadingText *tview.TextView) tview.Primitive {
 	state.Message = messageBox()
 	state.AlertChan = make(chan bool)
 	go state.MessageAnimationHandler()
+	var notes []string
+	if infoResult.Puzzle > 0 {
+		notes = append(notes, fmt.Sprintf("Puzzle #%d", infoResult.Puzzle))
+	}
+	if infoResult.HardMode {
+		notes = append(notes, "Hard mode: revealed hints must be reused")
+	}
+	if len(notes) > 0 {
+		state.SetMessage(strings.Join(notes, " - "), true)
+	}
+	if c, ok := session.(*client.Client); ok {
+		c.Shutdown = func(notice *game.ShutdownNotice) {
+			left := time.Until(notice.Deadline).Round(time.Second)
+			state.SetMessage(fmt.Sprintf("%s, %v left to finish", notice.Message, left), false)
+		}
+	}
 
 	grid := tview.NewGrid().
 		SetRows(guessRows...).
@@ -208,6 +397,11 @@ func generateLevel(level int, loadingText *tview.TextView) tview.Primitive {
 			inputLetter.SetBackgroundColor(colorGray)
 			inputLetter.SetBackgroundColorActivated(colorGray)
 			inputLetter.SetLabelColorActivated(colorWhite)
+			if state.isSeparator(j) {
+				inputLetter.SetLabel("[::b]" + string(state.Separators[j]))
+				inputLetter.SetBackgroundColor(colorBlack)
+				inputLetter.SetBackgroundColorActivated(colorBlack)
+			}
 			state.Letters = append(state.Letters, inputLetter)
 
 			grid.AddItem(inputLetter, i+4, j+2, 1, 1, 0, 0, false)
@@ -216,9 +410,28 @@ func generateLevel(level int, loadingText *tview.TextView) tview.Primitive {
 
 	app.SetFocus(state.Letters[state.LetterIndex])
 
-	grid.SetInputCapture(gameboardInputHandler(&state))
+	return grid, state
+}
 
-	return grid
+// startGame starts a game of level on the server, or in-process offline.
+func startGame(level game.LevelInfo, loadingText *tview.TextView) (client.Session, error) {
+	if offline {
+		return offlineGame(level.Number)
+	}
+
+	c, err := client.New(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	c.Progress = loadingText
+
+	err = c.ConnectLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(time.Second)
+
+	return c, nil
 }
 
 func messageBox() *tview.Button {
@@ -227,7 +440,7 @@ func messageBox() *tview.Button {
 	return b
 }
 
-func buildCandidates(candidates []rune) (map[rune]*tview.Button, tview.Primitive) {
+func buildCandidates(candidates []string) (map[string]*tview.Button, tview.Primitive) {
 	candidateRange := 250 - 20
 	rowRange := 28 - 8
 	rowSize := ((len(candidates) * rowRange) / candidateRange) + 8
@@ -237,7 +450,7 @@ func buildCandidates(candidates []rune) (map[rune]*tview.Button, tview.Primitive
 		SetBorders(false).
 		SetGap(1, 1)
 
-	buttons := make(map[rune]*tview.Button)
+	buttons := make(map[string]*tview.Button)
 	col := -1
 	row := -1
 	for i, c := range candidates {
@@ -246,7 +459,7 @@ func buildCandidates(candidates []rune) (map[rune]*tview.Button, tview.Primitive
 			row += 1
 		}
 
-		newButton := tview.NewButton("[::b]" + string(c))
+		newButton := tview.NewButton("[::b]" + c)
 		newButton.SetLabelColor(colorWhite)
 		newButton.SetBackgroundColor(colorLightGray)
 		buttons[c] = newButton
@@ -260,8 +473,15 @@ func buildCandidates(candidates []rune) (map[rune]*tview.Button, tview.Primitive
 func gameboardInputHandler(state *State) func(event *tcell.EventKey) *tcell.EventKey {
 	return func(event *tcell.EventKey) *tcell.EventKey {
 		if state.Complete {
-			pages.RemovePage("Level")
-			pages.SwitchToPage("Level Selector")
+			switch event.Rune() {
+			case 'c', 'C':
+				shareResult(state, copyToClipboard, "Copied to clipboard")
+			case 's', 'S':
+				shareResult(state, saveShareGrid, "Saved to "+shareFile)
+			default:
+				state.Session.Close()
+				switchToLevelSelector()
+			}
 			return nil
 		}
 
@@ -275,8 +495,16 @@ func gameboardInputHandler(state *State) func(event *tcell.EventKey) *tcell.Even
 			return nil
 		}
 
+		if event.Key() == tcell.KeyTab {
+			showHint(state)
+			return nil
+		}
+
 		if len(string(event.Rune())) > 0 && !unicode.IsSpace(event.Rune()) {
-			addLetter(unicode.ToUpper(event.Rune()), state)
+			if state.Graphemes && extendLetter(event.Rune(), state) {
+				return nil
+			}
+			addLetter(string(unicode.ToUpper(event.Rune())), state)
 			return nil
 		}
 
@@ -284,54 +512,100 @@ func gameboardInputHandler(state *State) func(event *tcell.EventKey) *tcell.Even
 	}
 }
 
-func addLetter(letter rune, state *State) {
-	state.CurrentLetter().SetLabel("[::b]" + string(letter))
+func addLetter(letter string, state *State) {
+	state.CurrentLetter().SetLabel("[::b]" + letter)
 
-	if state.LetterIndex == state.WordLen-1 {
+	next := state.seekLetter(state.LetterIndex+1, 1)
+	if next < 0 {
 		return
 	}
-	state.LetterIndex = (state.LetterIndex + 1) % state.WordLen
+	state.LetterIndex = next
 
 	app.SetFocus(state.CurrentLetter())
 }
 
+// extendLetter adds r to the last typed letter if they form a single grapheme
+// cluster, e.g. a combining mark or the second half of a flag.
+func extendLetter(r rune, state *State) bool {
+	i := state.LetterIndex
+	if state.LetterLabel(i) == "" {
+		i = state.seekLetter(i-1, -1)
+	}
+	if i < 0 || state.LetterLabel(i) == "" {
+		return false
+	}
+
+	letter := state.LetterLabel(i) + string(r)
+	if uniseg.GraphemeClusterCount(letter) != 1 {
+		return false
+	}
+
+	state.CurrentLetters()[i].SetLabel("[::b]" + letter)
+	return true
+}
+
 func removeLetter(state *State) {
-	if state.LetterIndex == 0 {
+	previous := state.seekLetter(state.LetterIndex-1, -1)
+	if previous < 0 {
 		return
 	}
 
-	if state.LetterIndex == state.WordLen-1 && len(state.CurrentLetter().GetLabel()) != 0 {
+	if state.seekLetter(state.LetterIndex+1, 1) < 0 && len(state.CurrentLetter().GetLabel()) != 0 {
 		state.CurrentLetter().SetLabel("")
 		return
 	}
 
-	state.LetterIndex = (state.LetterIndex - 1) % state.WordLen
+	state.LetterIndex = previous
 
 	state.CurrentLetter().SetLabel("")
 	app.SetFocus(state.CurrentLetter())
 }
 
+// sharePrompt is appended to the message of a finished game.
+const sharePrompt = " - c: copy result, s: save result"
+
+func shareResult(state *State, share func(string) error, done string) {
+	err := share(shareGrid(state))
+	if err != nil {
+		log.Println(err)
+		state.SetMessage(err.Error(), true)
+		return
+	}
+
+	state.SetMessage(done, true)
+}
+
 func sendGuess(state *State) {
 	guess := ""
-	for _, l := range state.CurrentLetters() {
-		styled := []rune(l.GetLabel())
-		if len(styled) != 6 {
+	for i := range state.CurrentLetters() {
+		letter := state.LetterLabel(i)
+		if letter == "" {
 			state.SetMessage("Not enough letters", true)
 			return
 		}
-		guess += string(styled[len(styled)-1:])
+		guess += letter
 	}
 
-	guessResult, err := makeRequest[*game.GuessResult](state.Conn, game.Request{
-		Type: game.RequestGuess,
-		Data: guess,
-	})
+	guessResult, err := state.Session.Guess(guess)
 	if err != nil {
 		log.Println(err)
 		state.SetMessage(err.Error(), true)
 		return
 	}
 
+	showResult(state, guess, guessResult)
+
+	if guessResult.Complete {
+		err = state.Session.SaveCert(clientConfig.CertDir)
+		if err != client.ErrNoCert {
+			check.Fatal("failed to save next level client certificate", err)
+		}
+	}
+}
+
+// showResult shows the result of guess on the board, moving on to the next
+// guess unless it was rejected or the game is over.
+func showResult(state *State, guess string, guessResult *game.GuessResult) {
 	if len(guessResult.Error) != 0 {
 		log.Println(guessResult.Error)
 		state.SetMessage(guessResult.Error, true)
@@ -339,33 +613,70 @@ func sendGuess(state *State) {
 	}
 
 	state.UpdateIndicators(guessResult.Indicators)
+	state.History = append(state.History, guessResult.Indicators)
+	if state.Solver != nil {
+		state.Solver.Add(guess, guessResult.Indicators)
+	}
 
 	if guessResult.Complete {
 		state.Complete = true
-		state.SetMessage(guessResult.CompleteMessage, false)
+		state.Solved = true
+		state.SetMessage(guessResult.CompleteMessage+sharePrompt, false)
 		log.Printf("level %d completed", state.Level)
-
-		if state.Level < 4 {
-			next := state.Level + 1
-			err = os.WriteFile(fmt.Sprintf("certs/level%d.pem", next), guessResult.ClientCert.Cert, 0600)
-			check.Fatal(fmt.Sprintf("failed to write level %d client certificate", next), err)
-			err = os.WriteFile(fmt.Sprintf("certs/level%d.key", next), guessResult.ClientCert.Key, 0600)
-			check.Fatal(fmt.Sprintf("failed to write level %d client key", next), err)
-		}
-
 		return
 	}
 
 	state.GuessIndex += 1
-	state.LetterIndex = 0
+	state.LetterIndex = state.seekLetter(0, 1)
 
 	if state.GuessIndex >= state.Guesses {
 		state.Complete = true
-		state.SetMessage("Better luck next time", false)
+		state.SetMessage("Better luck next time"+sharePrompt, false)
 		state.GuessIndex = state.Guesses - 1
 		return
 	}
 
+	if state.Solver != nil {
+		state.SetMessage(remainingMessage(state.Solver), true)
+	}
+
 	app.SetFocus(state.CurrentLetter())
 	log.Printf("received guess result: %+v", guessResult)
 }
+
+func remainingMessage(solver *client.Solver) string {
+	n, exact := solver.Remaining()
+	if n == 1 && exact {
+		return "1 possible word"
+	}
+	if exact {
+		return fmt.Sprintf("%d possible words", n)
+	}
+
+	return fmt.Sprintf("Up to %d possible words", n)
+}
+
+// showHint fills the current guess with the suggestion of the solver.
+func showHint(state *State) {
+	if state.Solver == nil {
+		state.SetMessage("Hints are disabled for this level", true)
+		return
+	}
+
+	suggestion := state.Solver.Suggest()
+	if suggestion == "" {
+		state.SetMessage("No word fits, is the word list complete?", true)
+		return
+	}
+
+	letters := game.SplitLetters(suggestion, state.Graphemes)
+	for i, letter := range letters {
+		if i < state.WordLen && !state.isSeparator(i) {
+			state.CurrentLetters()[i].SetLabel("[::b]" + letter)
+		}
+	}
+	state.LetterIndex = state.seekLetter(state.WordLen-1, -1)
+	app.SetFocus(state.CurrentLetter())
+
+	state.SetMessage("Hint: "+suggestion+", "+remainingMessage(state.Solver), true)
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// WordSource provides the answers of a level and the dictionary its guesses
+// are checked against. Server levels and offline games share them.
+type WordSource interface {
+	// Word picks an answer, drawing random numbers from intn, which behaves
+	// like rand.Intn.
+	Word(intn func(n int) int) []rune
+	// Allowed reports whether guess is in the dictionary of the source.
+	Allowed(guess []rune) bool
+}
+
+// WordList picks answers from a list of words. Guesses are allowed if they
+// are an answer or in a separate list of allowed guesses, as in Wordle where
+// far more words are accepted than are ever picked.
+type WordList struct {
+	answers [][]rune
+	allowed map[string]struct{}
+}
+
+func NewWordList(answers, guesses [][]rune) (*WordList, error) {
+	if len(answers) == 0 {
+		return nil, errors.New("wordlist has no answers")
+	}
+
+	allowed := make(map[string]struct{})
+	for _, word := range answers {
+		allowed[string(word)] = struct{}{}
+	}
+	for _, word := range guesses {
+		allowed[string(word)] = struct{}{}
+	}
+
+	return &WordList{
+		answers: answers,
+		allowed: allowed,
+	}, nil
+}
+
+func (w *WordList) Word(intn func(n int) int) []rune {
+	return w.answers[intn(len(w.answers))]
+}
+
+func (w *WordList) Allowed(guess []rune) bool {
+	_, ok := w.allowed[string(guess)]
+	return ok
+}
+
+// Generator makes up answers from random letters of an alphabet. Any guess
+// of the right length made of letters of the alphabet is allowed.
+type Generator struct {
+	Alphabet  []string
+	Length    int
+	Graphemes bool
+}
+
+func (g *Generator) Word(intn func(n int) int) []rune {
+	var word []rune
+	for i := 0; i < g.Length; i++ {
+		word = append(word, []rune(g.Alphabet[intn(len(g.Alphabet))])...)
+	}
+
+	return word
+}
+
+func (g *Generator) Allowed(guess []rune) bool {
+	letters := SplitLetters(string(guess), g.Graphemes)
+	if len(letters) != g.Length {
+		return false
+	}
+
+	for _, letter := range letters {
+		if countLetter(g.Alphabet, letter) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReadWords reads a word per line, upper cased, skipping blank lines. Lists
+// may mix words of several lengths, with a positive length only the words of
+// that many letters are kept. Letters are counted as grapheme clusters if
+// graphemes is set.
+func ReadWords(r io.Reader, length int, graphemes bool) ([][]rune, error) {
+	var words [][]rune
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" {
+			continue
+		}
+
+		letters := []rune(strings.ToUpper(word))
+		if length > 0 && len(SplitLetters(string(letters), graphemes)) != length {
+			continue
+		}
+		words = append(words, letters)
+	}
+
+	return words, scanner.Err()
+}